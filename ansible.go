@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ansibleInventory holds hosts and groups as declared in an inventory file,
+// before variable precedence is resolved.
+type ansibleInventory struct {
+	hosts  map[string]map[string]interface{} // Host -> inline vars
+	groups map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	vars     map[string]interface{}
+	hosts    map[string]bool
+	children map[string]bool
+}
+
+// hostRangePattern matches Ansible host ranges such as web[01:10]
+var hostRangePattern = regexp.MustCompile(`^(.*)\[(\d+):(\d+)\](.*)$`)
+
+// loadAnsibleInventory loads hosts from a YAML or INI Ansible inventory file.
+// Variables are resolved like Ansible does: inventory group vars from "all"
+// down to the most specific groups, then group_vars/all, then the other
+// group_vars/ files, then inline host vars and host_vars/. Each host also gets
+// group_names, the sorted list of groups it belongs to.
+func loadAnsibleInventory(path, root string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	log.Printf("[INFO] Loading Ansible inventory: %s", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory: %w", err)
+	}
+
+	inv := newAnsibleInventory()
+	if isINIInventory(path, data) {
+		err = inv.parseINI(data)
+	} else {
+		err = inv.parseYAML(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse inventory: %w", withSource(path, data, err))
+	}
+
+	hosts, err := inv.resolve(filepath.Dir(path), opts)
+	if err != nil {
+		return err
+	}
+
+	nodeCount, err := mergeVars(allVars, sources, hosts, nil, NodeSource{Root: root, Path: path, Rel: filepath.Base(path)}, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Loaded %d hosts from %d groups", nodeCount, len(inv.groups))
+
+	return nil
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		hosts:  make(map[string]map[string]interface{}),
+		groups: make(map[string]*ansibleGroup),
+	}
+}
+
+func (inv *ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &ansibleGroup{
+			vars:     make(map[string]interface{}),
+			hosts:    make(map[string]bool),
+			children: make(map[string]bool),
+		}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost records a host (or host range) in a group with its inline vars.
+func (inv *ansibleInventory) addHost(group, pattern string, vars map[string]interface{}) error {
+	names, err := expandHostPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		hostVars := inv.hosts[name]
+		if hostVars == nil {
+			hostVars = make(map[string]interface{})
+			inv.hosts[name] = hostVars
+		}
+		for k, v := range vars {
+			hostVars[k] = v
+		}
+		inv.group(group).hosts[name] = true
+	}
+
+	return nil
+}
+
+// expandHostPattern expands a numeric range like db[01:03] (keeping zero
+// padding) into its host names.
+func expandHostPattern(pattern string) ([]string, error) {
+	m := hostRangePattern.FindStringSubmatch(pattern)
+	if m == nil {
+		return []string{pattern}, nil
+	}
+
+	start, _ := strconv.Atoi(m[2])
+	end, _ := strconv.Atoi(m[3])
+	if end < start {
+		return nil, fmt.Errorf("invalid host range %s", pattern)
+	}
+
+	width := 0
+	if strings.HasPrefix(m[2], "0") {
+		width = len(m[2])
+	}
+
+	var names []string
+	for i := start; i <= end; i++ {
+		rest, err := expandHostPattern(m[4])
+		if err != nil {
+			return nil, err
+		}
+		for _, suffix := range rest {
+			names = append(names, fmt.Sprintf("%s%0*d%s", m[1], width, i, suffix))
+		}
+	}
+
+	return names, nil
+}
+
+// isINIInventory tells INI inventories apart from YAML ones by extension.
+// Without a known extension, as for the usual "hosts" file, an inventory
+// that parses as a YAML map is YAML and anything else is INI, including
+// files starting with ungrouped hosts before any [section].
+func isINIInventory(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return false
+	case ".ini":
+		return true
+	}
+
+	var groups yaml.MapSlice
+	return yaml.UnmarshalWithOptions(data, &groups, yaml.UseOrderedMap()) != nil || groups == nil
+}
+
+// parseYAML reads the YAML inventory layout of nested groups, each with
+// optional hosts, vars and children. Groups and hosts are walked in file
+// order, so a host listed in several groups gets the inline vars declared
+// last, as in Ansible.
+func (inv *ansibleInventory) parseYAML(data []byte) error {
+	var groups yaml.MapSlice
+	if err := yaml.UnmarshalWithOptions(data, &groups, yaml.UseOrderedMap()); err != nil {
+		return yamlError("failed to parse YAML", err)
+	}
+
+	for _, item := range groups {
+		if err := inv.parseYAMLGroup(fmt.Sprint(item.Key), item.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (inv *ansibleInventory) parseYAMLGroup(name string, def interface{}) error {
+	g := inv.group(name)
+	if def == nil {
+		return nil
+	}
+
+	body, ok := def.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("group %s is not a map", name)
+	}
+
+	hosts, _ := orderedGet(body, "hosts").(yaml.MapSlice)
+	for _, item := range hosts {
+		vars, _ := plainValue(item.Value).(map[string]interface{})
+		if err := inv.addHost(name, fmt.Sprint(item.Key), vars); err != nil {
+			return err
+		}
+	}
+
+	vars, _ := plainValue(orderedGet(body, "vars")).(map[string]interface{})
+	for k, v := range vars {
+		g.vars[k] = v
+	}
+
+	children, _ := orderedGet(body, "children").(yaml.MapSlice)
+	for _, item := range children {
+		child := fmt.Sprint(item.Key)
+		g.children[child] = true
+		if err := inv.parseYAMLGroup(child, item.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orderedGet returns the value of key in an ordered map, nil if missing.
+func orderedGet(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// plainValue converts ordered maps decoded with yaml.UseOrderedMap back to
+// the plain maps used for vars.
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			m[fmt.Sprint(item.Key)] = plainValue(item.Value)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = plainValue(item)
+		}
+		return list
+	default:
+		return value
+	}
+}
+
+// parseINI reads the INI inventory layout: [group], [group:vars] and
+// [group:children] sections, with hosts before any section ungrouped.
+func (inv *ansibleInventory) parseINI(data []byte) error {
+	group, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group, kind = line[1:len(line)-1], "hosts"
+			if name, suffix, ok := strings.Cut(group, ":"); ok {
+				group, kind = name, suffix
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return positionError(lineNum, 1, fmt.Sprintf("unknown section type %q", kind), nil)
+			}
+			inv.group(group)
+			continue
+		}
+
+		fields, err := splitINIFields(line)
+		if err != nil {
+			return positionError(lineNum, 1, err.Error(), err)
+		}
+
+		switch kind {
+		case "hosts":
+			vars := make(map[string]interface{})
+			for _, field := range fields[1:] {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					return positionError(lineNum, 1, fmt.Sprintf("expected key=value, got %q", field), nil)
+				}
+				vars[key] = parseINILiteral(value)
+			}
+			host := fields[0]
+			if i := strings.LastIndex(host, ":"); i > 0 && isDigits(host[i+1:]) {
+				vars["ansible_port"], _ = strconv.Atoi(host[i+1:])
+				host = host[:i]
+			}
+			if err := inv.addHost(group, host, vars); err != nil {
+				return positionError(lineNum, 1, err.Error(), err)
+			}
+
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return positionError(lineNum, 1, fmt.Sprintf("expected key=value, got %q", line), nil)
+			}
+			// Values in :vars sections are always strings in Ansible
+			inv.group(group).vars[strings.TrimSpace(key)] = unquoteINI(strings.TrimSpace(value))
+
+		case "children":
+			inv.group(group).children[fields[0]] = true
+			inv.group(fields[0])
+		}
+	}
+
+	return scanner.Err()
+}
+
+// splitINIFields splits a host line on whitespace, keeping quoted values
+// together.
+func splitINIFields(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			current.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+
+	return fields, nil
+}
+
+// parseINILiteral interprets inline host values the way Ansible does for
+// simple literals: numbers, booleans and quoted strings.
+func parseINILiteral(value string) interface{} {
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	switch value {
+	case "True", "true":
+		return true
+	case "False", "false":
+		return false
+	}
+	return unquoteINI(value)
+}
+
+func unquoteINI(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve computes the final vars of every host, reading group_vars/ and
+// host_vars/ from dir.
+func (inv *ansibleInventory) resolve(dir string, opts LoadOptions) (map[string]interface{}, error) {
+	// Hosts in no group other than "all" are "ungrouped", and every group is
+	// implicitly a child of "all"
+	for host := range inv.hosts {
+		grouped := false
+		for name, g := range inv.groups {
+			grouped = grouped || (name != "all" && g.hosts[host])
+		}
+		if !grouped {
+			inv.group("ungrouped").hosts[host] = true
+		}
+	}
+
+	all := inv.group("all")
+	isChild := make(map[string]bool)
+	for _, g := range inv.groups {
+		for child := range g.children {
+			isChild[child] = true
+		}
+	}
+	for name := range inv.groups {
+		if name != "all" && !isChild[name] {
+			all.children[name] = true
+		}
+	}
+
+	depths := inv.groupDepths()
+	parents := inv.groupParents()
+
+	groupFiles := make(map[string]map[string]interface{})
+	for name := range inv.groups {
+		fileVars, err := loadAnsibleVarsDir(filepath.Join(dir, "group_vars"), name, opts)
+		if err != nil {
+			return nil, err
+		}
+		groupFiles[name] = fileVars
+	}
+
+	hosts := make(map[string]interface{}, len(inv.hosts))
+	for host, inline := range inv.hosts {
+		groups := inv.hostGroups(host, parents)
+		sort.Slice(groups, func(i, j int) bool {
+			return groupLess(groups[i], groups[j], depths, inv.groups)
+		})
+
+		// Ansible stacks every inventory group's vars by depth, then
+		// group_vars/all, then the other group_vars files by depth, then
+		// the host's inline vars and finally host_vars
+		vars := make(map[string]interface{})
+		var names []string
+		for _, name := range groups {
+			vars = mergeShallow(vars, inv.groups[name].vars)
+			if name != "all" {
+				names = append(names, name)
+			}
+		}
+		vars = mergeShallow(vars, groupFiles["all"])
+		for _, name := range names {
+			vars = mergeShallow(vars, groupFiles[name])
+		}
+		vars = mergeShallow(vars, inline)
+
+		fileVars, err := loadAnsibleVarsDir(filepath.Join(dir, "host_vars"), host, opts)
+		if err != nil {
+			return nil, err
+		}
+		vars = mergeShallow(vars, fileVars)
+
+		sort.Strings(names)
+		groupNames := make([]interface{}, len(names))
+		for i, name := range names {
+			groupNames[i] = name
+		}
+		vars["group_names"] = groupNames
+
+		hosts[host] = vars
+	}
+
+	return hosts, nil
+}
+
+// groupLess orders groups like Ansible: by depth below "all", then by
+// ansible_group_priority, then by name. The priority is only read from the
+// inventory itself, as Ansible ignores it in group_vars files.
+func groupLess(a, b string, depths map[string]int, groups map[string]*ansibleGroup) bool {
+	if depths[a] != depths[b] {
+		return depths[a] < depths[b]
+	}
+	pa, pb := groupPriority(groups[a].vars), groupPriority(groups[b].vars)
+	if pa != pb {
+		return pa < pb
+	}
+	return a < b
+}
+
+func groupPriority(vars map[string]interface{}) int {
+	p, err := strconv.Atoi(fmt.Sprint(vars["ansible_group_priority"]))
+	if err != nil {
+		return 1
+	}
+	return p
+}
+
+// groupDepths returns each group's longest distance from "all".
+func (inv *ansibleInventory) groupDepths() map[string]int {
+	depths := map[string]int{"all": 0}
+
+	var visit func(name string, depth int, path map[string]bool)
+	visit = func(name string, depth int, path map[string]bool) {
+		if path[name] {
+			return // Cycle in children, ignore the back edge
+		}
+		if d, ok := depths[name]; ok && d >= depth && name != "all" {
+			return
+		}
+		depths[name] = depth
+		path[name] = true
+		for child := range inv.groups[name].children {
+			visit(child, depth+1, path)
+		}
+		delete(path, name)
+	}
+	visit("all", 0, map[string]bool{})
+
+	return depths
+}
+
+func (inv *ansibleInventory) groupParents() map[string][]string {
+	parents := make(map[string][]string)
+	for name, g := range inv.groups {
+		for child := range g.children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	return parents
+}
+
+// hostGroups returns every group a host belongs to, directly or through
+// group children.
+func (inv *ansibleInventory) hostGroups(host string, parents map[string][]string) []string {
+	seen := make(map[string]bool)
+	var queue []string
+	for name, g := range inv.groups {
+		if g.hosts[host] {
+			queue = append(queue, name)
+		}
+	}
+	queue = append(queue, "all")
+
+	var groups []string
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		groups = append(groups, name)
+		queue = append(queue, parents[name]...)
+	}
+
+	return groups
+}
+
+// loadAnsibleVarsDir loads <dir>/<name>.{yml,yaml,json} or, when
+// <dir>/<name> is a directory, every vars file inside it in lexical order.
+func loadAnsibleVarsDir(dir, name string, opts LoadOptions) (map[string]interface{}, error) {
+	base := filepath.Join(dir, name)
+
+	if info, err := os.Stat(base); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(base)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", base, err)
+		}
+		vars := make(map[string]interface{})
+		for _, entry := range entries {
+			format := varsExtensions[strings.ToLower(filepath.Ext(entry.Name()))]
+			if entry.IsDir() || format == "" {
+				continue
+			}
+			fileVars, err := loadAnsibleVarsFile(filepath.Join(base, entry.Name()), format, opts)
+			if err != nil {
+				return nil, err
+			}
+			vars = mergeShallow(vars, fileVars)
+		}
+		return vars, nil
+	}
+
+	for _, ext := range []string{"", ".yml", ".yaml", ".json"} {
+		path := base + ext
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			format := varsExtensions[ext]
+			if format == "" {
+				format = "yaml"
+			}
+			return loadAnsibleVarsFile(path, format, opts)
+		}
+	}
+
+	return nil, nil
+}
+
+func loadAnsibleVarsFile(path, format string, opts LoadOptions) (map[string]interface{}, error) {
+	if opts.Verbose {
+		log.Printf("[DEBUG] Loading: %s", path)
+	}
+	return loadVarsFile(path, format, opts.plain())
+}
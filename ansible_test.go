@@ -0,0 +1,183 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Ansible inventories resolve into the node map
+func TestLoadAnsibleInventory(t *testing.T) {
+	inventories := map[string]string{
+		"hosts.yml": `
+all:
+  vars:
+    owner: platform
+    env: dev
+  hosts:
+    bastion:
+  children:
+    web:
+      vars:
+        role: web
+      hosts:
+        web[01:02]:
+          ansible_host: 10.0.0.1
+    prod:
+      vars:
+        env: prod
+      children:
+        web:
+`,
+		"hosts.ini": `
+bastion
+
+[web]
+web[01:02] ansible_host=10.0.0.1
+
+[web:vars]
+role=web
+
+[prod:children]
+web
+
+[prod:vars]
+env=prod
+
+[all:vars]
+owner=platform
+env=dev
+`,
+	}
+	// The usual extension-less file, starting with an ungrouped host
+	inventories["hosts"] = inventories["hosts.ini"]
+
+	for name, content := range inventories {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeVarsFiles(t, dir, map[string]string{
+				name:                    content,
+				"group_vars/web.yml":    "role: frontend\nport: 80\n",
+				"host_vars/web02/a.yml": "ansible_host: 10.0.0.2\n",
+			})
+
+			vars := map[string]interface{}{}
+			sources := map[string]NodeSource{}
+			path := filepath.Join(dir, name)
+			if err := loadAnsibleInventory(path, "ansible:"+path, LoadOptions{}, vars, sources); err != nil {
+				t.Fatalf("loadAnsibleInventory() error = %v", err)
+			}
+
+			if len(vars) != 3 {
+				t.Fatalf("loaded %d hosts, want 3: %v", len(vars), vars)
+			}
+
+			web02 := vars["web02"].(map[string]interface{})
+			want := map[string]interface{}{
+				"owner":        "platform",
+				"env":          "prod",
+				"role":         "frontend",
+				"port":         uint64(80),
+				"ansible_host": "10.0.0.2",
+				"group_names":  []interface{}{"prod", "web"},
+			}
+			if !reflect.DeepEqual(web02, want) {
+				t.Errorf("web02 = %v, want %v", web02, want)
+			}
+
+			bastion := vars["bastion"].(map[string]interface{})
+			if bastion["env"] != "dev" || !reflect.DeepEqual(bastion["group_names"], []interface{}{"ungrouped"}) {
+				t.Errorf("bastion = %v", bastion)
+			}
+		})
+	}
+}
+
+// A host's inline vars from the group declared last win, like Ansible
+func TestAnsibleInventoryHostVarsOrder(t *testing.T) {
+	tests := []struct {
+		inventory string
+		want      string
+	}{
+		{inventory: "aaa:\n  hosts:\n    h1: {role: a}\nzzz:\n  hosts:\n    h1: {role: z}\n", want: "z"},
+		{inventory: "zzz:\n  hosts:\n    h1: {role: z}\naaa:\n  hosts:\n    h1: {role: a}\n", want: "a"},
+		{inventory: "all:\n  children:\n    zzz:\n      hosts:\n        h1: {role: z}\n    aaa:\n      hosts:\n        h1: {role: a}\n", want: "a"},
+	}
+
+	for _, tt := range tests {
+		// Repeat to catch map iteration order leaking into the result
+		for run := 0; run < 20; run++ {
+			inv := newAnsibleInventory()
+			if err := inv.parseYAML([]byte(tt.inventory)); err != nil {
+				t.Fatalf("parseYAML() error = %v", err)
+			}
+			if got := inv.hosts["h1"]["role"]; got != tt.want {
+				t.Fatalf("role = %v, want %s for inventory:\n%s", got, tt.want, tt.inventory)
+			}
+		}
+	}
+}
+
+// Conflicting layers resolve in Ansible's order: inventory group vars by
+// depth, group_vars/all, group_vars/<group> by depth, inline host vars,
+// host_vars
+func TestAnsibleInventoryPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"hosts": `web1 a=inline-host
+web2
+
+[web]
+web1
+web2
+
+[web:vars]
+a=inline-web
+b=inline-web
+c=inline-web
+d=inline-web
+
+[all:vars]
+e=inline-all
+`,
+		"group_vars/all.yml": "b: groupvars-all\nc: groupvars-all\nd: groupvars-all\n",
+		"group_vars/web.yml": "c: groupvars-web\nd: groupvars-web\n",
+		"host_vars/web1.yml": "a: hostvars\nd: hostvars\n",
+	})
+
+	vars := map[string]interface{}{}
+	path := filepath.Join(dir, "hosts")
+	if err := loadAnsibleInventory(path, "ansible:"+path, LoadOptions{}, vars, map[string]NodeSource{}); err != nil {
+		t.Fatalf("loadAnsibleInventory() error = %v", err)
+	}
+
+	tests := []struct {
+		host  string
+		field string
+		want  string
+	}{
+		{host: "web1", field: "a", want: "hostvars"},
+		{host: "web2", field: "a", want: "inline-web"},
+		{host: "web1", field: "b", want: "groupvars-all"},
+		{host: "web1", field: "c", want: "groupvars-web"},
+		{host: "web1", field: "d", want: "hostvars"},
+		{host: "web2", field: "d", want: "groupvars-web"},
+		{host: "web2", field: "e", want: "inline-all"},
+	}
+	for _, tt := range tests {
+		if got := vars[tt.host].(map[string]interface{})[tt.field]; got != tt.want {
+			t.Errorf("%s %s = %v, want %s", tt.host, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestExpandHostPattern(t *testing.T) {
+	got, err := expandHostPattern("db[08:10].example")
+	if err != nil {
+		t.Fatalf("expandHostPattern() error = %v", err)
+	}
+	want := []string{"db08.example", "db09.example", "db10.example"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandHostPattern() = %v, want %v", got, want)
+	}
+}
@@ -5,17 +5,41 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 // Config holds all command-line configuration
 type Config struct {
-	VarsPath    string
+	VarsPaths   stringList
+	VarsFormat  string
+	VarsRoot    string
+	VarsListKey string
+	Overlays    stringList
+	Include     stringList
+	Exclude     stringList
+	Duplicates  string
+	ListMerge   string
+	TFResources stringList
+	TFKey       string
+	CSVKey      string
+	CSVListSep  string
+	Strict      bool
+	LoadWorkers int
 	MappingFile string
 	Datacenter  string
 	ConsulAddr  string
 	DryRun      bool
 	Verbose     bool
 	Payload     bool
+	WaitHealthy bool
+	WaitStatus  string
+	WaitTimeout time.Duration
+	Limit       stringList
+	Select      stringList
+	LimitSource stringList
+	Safety      SafetyThresholds
+	Force       bool
 }
 
 func parseConfig() Config {
@@ -34,6 +58,54 @@ func parseConfig() Config {
 		os.Exit(1)
 	}
 
+	stdinUses := 0
+	for _, path := range append(config.VarsPaths, config.Overlays...) {
+		if path == stdinPath {
+			stdinUses++
+		}
+	}
+	if config.MappingFile == stdinPath {
+		stdinUses++
+	}
+	if stdinUses > 1 {
+		fmt.Fprintf(os.Stderr, "Error: only one of -vars, -overlay and -mapping can read from stdin\n")
+		os.Exit(1)
+	}
+
+	if config.VarsFormat != "" && !isVarsFormat(config.VarsFormat) {
+		fmt.Fprintf(os.Stderr, "Error: invalid -vars-format %q (expected yaml, json, toml, hcl or csv)\n", config.VarsFormat)
+		os.Exit(1)
+	}
+
+	// The -min-ops-percent baseline is the whole catalog, which a partial
+	// run can never cover
+	if config.Safety.MinOpsPercent > 0 && len(config.Limit)+len(config.Select)+len(config.LimitSource) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: -min-ops-percent cannot be combined with -limit, -select or -limit-source\n")
+		os.Exit(1)
+	}
+
+	if config.LoadWorkers < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -load-workers %d (expected at least 1)\n", config.LoadWorkers)
+		os.Exit(1)
+	}
+
+	switch config.Duplicates {
+	case "error", "first", "last", "deep-merge":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid -duplicates %q (expected error, first, last or deep-merge)\n", config.Duplicates)
+		os.Exit(1)
+	}
+
+	if config.ListMerge != "replace" && config.ListMerge != "append" {
+		fmt.Fprintf(os.Stderr, "Error: invalid -merge-lists %q (expected replace or append)\n", config.ListMerge)
+		os.Exit(1)
+	}
+
+	if _, ok := checkSeverity[config.WaitStatus]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: invalid -wait-status %q (expected passing, warning or critical)\n", config.WaitStatus)
+		os.Exit(1)
+	}
+
 	return config
 }
 
@@ -43,13 +115,38 @@ func parseFlags() (Config, bool) {
 
 	flag.Usage = showUsage
 
-	flag.StringVar(&config.VarsPath, "vars", "", "vars file or directory path (required)")
-	flag.StringVar(&config.MappingFile, "mapping", "", "mapping file path (required)")
+	flag.Var(&config.VarsPaths, "vars", "vars file, directory or glob, - for stdin; repeatable, loaded in order (required)")
+	flag.StringVar(&config.VarsFormat, "vars-format", "", "force vars format: yaml, json, toml, hcl or csv (default: detect from extension)")
+	flag.StringVar(&config.VarsRoot, "vars-root", "", "dotted path to the nodes inside each vars file (default: top level)")
+	flag.StringVar(&config.VarsListKey, "vars-list-key", "name", "field naming each node when the nodes are a list of objects")
+	flag.Var(&config.Overlays, "overlay", "vars path deep-merged onto the loaded vars; __remove__ deletes a node or field; repeatable")
+	flag.Var(&config.Include, "include", "only load vars directory files matching this glob; repeatable")
+	flag.Var(&config.Exclude, "exclude", "skip vars directory files and directories matching this glob; repeatable")
+	flag.StringVar(&config.Duplicates, "duplicates", "first", "duplicate node policy: error, first, last or deep-merge")
+	flag.StringVar(&config.ListMerge, "merge-lists", "replace", "how deep-merge combines lists: replace or append")
+	flag.Var(&config.TFResources, "tf-resources", "terraform: sources only load resources (type or address) or outputs matching these comma-separated globs; repeatable")
+	flag.StringVar(&config.TFKey, "tf-key", "", "terraform: attribute (dotted path) used as node name (default: resource address)")
+	flag.StringVar(&config.CSVKey, "csv-key", "", "CSV column used as node name (default: first column)")
+	flag.StringVar(&config.CSVListSep, "csv-list-sep", defaultCSVListSep, "separator for CSV columns hinted as list")
+	flag.IntVar(&config.LoadWorkers, "load-workers", defaultLoadWorkers, "number of vars files parsed concurrently when loading a directory")
+	flag.BoolVar(&config.Strict, "strict", false, "fail on unreadable or unparsable vars files, non-map nodes and duplicate nodes instead of skipping them")
+	flag.StringVar(&config.MappingFile, "mapping", "", "mapping file path, - for stdin (required)")
 	flag.StringVar(&config.Datacenter, "datacenter", "dc1", "target datacenter (default: dc1)")
 	flag.StringVar(&config.ConsulAddr, "consul-addr", "http://127.0.0.1:8500", "Consul HTTP address")
 	flag.BoolVar(&config.DryRun, "dry-run", false, "show operations without executing")
 	flag.BoolVar(&config.Verbose, "verbose", false, "verbose output")
 	flag.BoolVar(&config.Payload, "payload", false, "output JSON payload that would be sent to Consul API (NDJSON format)")
+	flag.Var(&config.Limit, "limit", "only sync nodes whose key matches one of these comma-separated globs, or a ~regex (to the end of the value); repeatable")
+	flag.Var(&config.Select, "select", "only sync nodes whose vars match all comma-separated field=value or field!=value expressions; repeatable")
+	flag.Var(&config.LimitSource, "limit-source", "only sync nodes loaded from files matching one of these comma-separated globs; repeatable")
+	flag.BoolVar(&config.WaitHealthy, "wait-healthy", false, "wait for registered services and checks to become healthy")
+	flag.StringVar(&config.WaitStatus, "wait-status", "passing", "health status to wait for: passing, warning or critical")
+	flag.DurationVar(&config.WaitTimeout, "wait-timeout", 5*time.Minute, "maximum time to wait for health checks")
+	flag.IntVar(&config.Safety.MaxDeletes, "max-deletes", -1, "abort if more delete operations are generated (-1 disables)")
+	flag.Float64Var(&config.Safety.MaxDeletePercent, "max-delete-percent", -1, "abort if deletions exceed this percentage of operations (-1 disables)")
+	flag.IntVar(&config.Safety.MaxNodesChanged, "max-nodes-changed", -1, "abort if more nodes are changed (-1 disables)")
+	flag.Float64Var(&config.Safety.MinOpsPercent, "min-ops-percent", 0, "abort if registrations fall below this percentage of the current catalog (0 disables)")
+	flag.BoolVar(&config.Force, "force", false, "apply even if a safety threshold is exceeded")
 	flag.BoolVar(&showVersion, "version", false, "show version")
 
 	flag.Parse()
@@ -57,8 +154,32 @@ func parseFlags() (Config, bool) {
 	return config, showVersion
 }
 
+// loadOptions returns the settings that control vars loading
+func (c Config) loadOptions() LoadOptions {
+	return LoadOptions{
+		Format:     c.VarsFormat,
+		Root:       c.VarsRoot,
+		ListKey:    c.VarsListKey,
+		Overlays:   c.Overlays,
+		Include:    c.Include,
+		Exclude:    c.Exclude,
+		Duplicates: c.Duplicates,
+		ListMerge:  c.ListMerge,
+
+		TFResources: splitValues(c.TFResources),
+		TFKey:       c.TFKey,
+
+		CSVKey:     c.CSVKey,
+		CSVListSep: c.CSVListSep,
+
+		Workers: c.LoadWorkers,
+		Strict:  c.Strict,
+		Verbose: c.Verbose,
+	}
+}
+
 func validateRequiredFlags(config Config) bool {
-	return config.VarsPath != "" && config.MappingFile != ""
+	return len(config.VarsPaths) > 0 && config.MappingFile != ""
 	// datacenter now has a default value, so it's not required
 }
 
@@ -68,14 +189,42 @@ func showUsage() {
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  %s -vars <path> -mapping <file> [options]\n\n", binaryName)
 	fmt.Fprintf(os.Stderr, "Required flags:\n")
-	fmt.Fprintf(os.Stderr, "  -vars        Path to vars file or directory containing YAML files\n")
-	fmt.Fprintf(os.Stderr, "  -mapping     Path to mapping rules file\n\n")
+	fmt.Fprintf(os.Stderr, "  -vars        Path to vars file, directory or glob containing YAML, JSON, TOML, HCL or CSV files\n")
+	fmt.Fprintf(os.Stderr, "               ansible:<inventory>, terraform:<state or output file> or git:<rev>:<path>\n")
+	fmt.Fprintf(os.Stderr, "               (repeatable, loaded in order; see -duplicates)\n")
+	fmt.Fprintf(os.Stderr, "  -mapping     Path to mapping rules file\n")
+	fmt.Fprintf(os.Stderr, "  Either path may be - to read a single document from stdin\n\n")
 	fmt.Fprintf(os.Stderr, "Optional flags:\n")
+	fmt.Fprintf(os.Stderr, "  -vars-format Force vars format: yaml, json, toml, hcl or csv (default: by extension)\n")
+	fmt.Fprintf(os.Stderr, "  -vars-root   Dotted path to the nodes inside each vars file, e.g. all.children.web.hosts\n")
+	fmt.Fprintf(os.Stderr, "  -vars-list-key Field naming each node when the nodes are a list (default: name)\n")
+	fmt.Fprintf(os.Stderr, "  -overlay     Vars path deep-merged onto the loaded vars (repeatable; see README)\n")
+	fmt.Fprintf(os.Stderr, "  -include     Only load vars directory files matching a glob (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -exclude     Skip vars directory files or directories matching a glob (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -duplicates  Duplicate node policy: error, first, last or deep-merge (default: first)\n")
+	fmt.Fprintf(os.Stderr, "  -merge-lists How deep-merge combines lists: replace or append (default: replace)\n")
+	fmt.Fprintf(os.Stderr, "  -tf-resources Only load Terraform resources or outputs matching these globs (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -tf-key      Terraform attribute used as node name (default: resource address)\n")
+	fmt.Fprintf(os.Stderr, "  -csv-key     CSV column used as node name (default: first column)\n")
+	fmt.Fprintf(os.Stderr, "  -csv-list-sep Separator for CSV columns hinted as list (default: ;)\n")
+	fmt.Fprintf(os.Stderr, "  -load-workers Vars files parsed concurrently per directory (default: %d)\n", defaultLoadWorkers)
+	fmt.Fprintf(os.Stderr, "  -strict      Fail on any broken vars file, non-map node or duplicate node\n")
 	fmt.Fprintf(os.Stderr, "  -datacenter  Target datacenter (default: dc1)\n")
 	fmt.Fprintf(os.Stderr, "  -consul-addr Consul HTTP address (default: http://127.0.0.1:8500)\n")
 	fmt.Fprintf(os.Stderr, "  -dry-run     Show operations without executing\n")
 	fmt.Fprintf(os.Stderr, "  -verbose     Verbose output\n")
 	fmt.Fprintf(os.Stderr, "  -payload     Output JSON payload (NDJSON format)\n")
+	fmt.Fprintf(os.Stderr, "  -limit       Only sync nodes whose key matches a glob or ~regex (comma-separated, repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -select      Only sync nodes matching field=value,field!=value expressions (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -limit-source Only sync nodes loaded from files or directories matching a glob (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  -wait-healthy Wait for registered services and checks to become healthy\n")
+	fmt.Fprintf(os.Stderr, "  -wait-status Health status to wait for (default: passing)\n")
+	fmt.Fprintf(os.Stderr, "  -wait-timeout Maximum time to wait for health checks (default: 5m)\n")
+	fmt.Fprintf(os.Stderr, "  -max-deletes Abort if more delete operations are generated (default: disabled)\n")
+	fmt.Fprintf(os.Stderr, "  -max-delete-percent Abort if deletions exceed this percentage of operations\n")
+	fmt.Fprintf(os.Stderr, "  -max-nodes-changed Abort if more nodes are changed (default: disabled)\n")
+	fmt.Fprintf(os.Stderr, "  -min-ops-percent Abort if registrations are below this percentage of the catalog\n")
+	fmt.Fprintf(os.Stderr, "  -force       Apply even if a safety threshold is exceeded\n")
 	fmt.Fprintf(os.Stderr, "  -version     Show version\n")
 	fmt.Fprintf(os.Stderr, "  -help        Show this help message\n")
 	fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -83,14 +232,50 @@ func showUsage() {
 	fmt.Fprintf(os.Stderr, "  %s -vars nodes.yaml -mapping mapping.yaml\n\n", binaryName)
 	fmt.Fprintf(os.Stderr, "  # Sync from directory with specific datacenter\n")
 	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -datacenter prod\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Load a list of hosts nested under a key, named by their hostname field\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars hosts.yaml -vars-root inventory.hosts -vars-list-key hostname -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Sync the shared inventory with staging differences applied\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars base/ -overlay overlays/staging/ -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Leave out archived hosts and drafts\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -exclude archive/ -exclude '*.draft.yaml' -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Load hosts from an Ansible inventory\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars ansible:inventory/hosts.yml -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Register VMs from Terraform state, named by their Name tag\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars terraform:terraform.tfstate -tf-resources aws_instance -tf-key tags.Name -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Preview the inventory as it was one commit ago\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars git:HEAD~1:inventory/ -mapping mapping.yaml -dry-run\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Load a rack inventory exported as CSV, keyed by its hostname column\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars racks.csv -csv-key hostname -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Merge shared and team-owned vars\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars shared/vars -vars 'team/*.yaml' -mapping mapping.yaml\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Read generated vars from a pipeline\n")
+	fmt.Fprintf(os.Stderr, "  inventory-gen | %s -vars - -mapping mapping.yaml\n\n", binaryName)
 	fmt.Fprintf(os.Stderr, "  # Use custom Consul address\n")
 	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -consul-addr http://consul.example.com:8500\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Refuse to sync if any vars file is broken\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -strict\n\n", binaryName)
 	fmt.Fprintf(os.Stderr, "  # Dry run to see what would be synced\n")
 	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -dry-run\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Sync only web nodes outside production\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -limit 'web-*' -select 'env!=prod'\n\n", binaryName)
+	fmt.Fprintf(os.Stderr, "  # Wait for services to pass their checks after syncing\n")
+	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -wait-healthy -wait-timeout 2m\n\n", binaryName)
 	fmt.Fprintf(os.Stderr, "  # Output JSON payload for debugging\n")
 	fmt.Fprintf(os.Stderr, "  %s -vars vars/ -mapping mapping.yaml -payload | jq '.'\n\n", binaryName)
 }
 
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func setupLogging(config Config) {
 	// Route all logs to stderr in payload mode so they never corrupt the
 	// NDJSON written to stdout.
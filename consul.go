@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 )
@@ -109,6 +110,59 @@ func sendRequest(client *http.Client, consulAddr string, payload []byte) (*http.
 	return resp, nil
 }
 
+// getJSON performs a GET against the Consul HTTP API and decodes the JSON
+// response into out.
+func getJSON(client *http.Client, consulAddr, path string, query url.Values, out interface{}) error {
+	endpoint := fmt.Sprintf("%s%s", consulAddr, path)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	setConsulToken(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
+
+// CatalogNode represents a node entry from the Consul Catalog API
+type CatalogNode struct {
+	Node    string            `json:"Node"`
+	Address string            `json:"Address"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// fetchCatalogNodes lists the nodes currently registered in the datacenter.
+func fetchCatalogNodes(client *http.Client, consulAddr, datacenter string) ([]CatalogNode, error) {
+	var nodes []CatalogNode
+	query := url.Values{"dc": {datacenter}}
+	if err := getJSON(client, consulAddr, "/v1/catalog/nodes", query, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to list catalog nodes: %w", err)
+	}
+	return nodes, nil
+}
+
 // setConsulToken adds the ACL token from CONSUL_HTTP_TOKEN when set, matching
 // the consul CLI convention (env only, never a flag, to keep it out of argv).
 func setConsulToken(req *http.Request) {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// defaultCSVListSep separates items in CSV columns hinted as list
+const defaultCSVListSep = ";"
+
+// csvColumn describes a CSV header: a dotted field path and a type hint
+// written as "field:type".
+type csvColumn struct {
+	name  string
+	path  []string
+	hint  string // string (default), int, float, bool or list
+	index int
+}
+
+// parseCSV reads one node per row. The key column (opts.CSVKey, or the
+// first column) names the node and every other non-empty cell becomes a
+// field. Headers may carry a type hint such as "port:int" or "tags:list",
+// and dotted headers such as "meta.rack" create nested maps.
+func parseCSV(data []byte, opts LoadOptions) (map[string]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	columns, keyIndex, err := parseCSVHeader(header, opts.CSVKey)
+	if err != nil {
+		line, _ := reader.FieldPos(0)
+		return nil, positionError(line, 1, err.Error(), err)
+	}
+
+	listSep := opts.CSVListSep
+	if listSep == "" {
+		listSep = defaultCSVListSep
+	}
+
+	result := make(map[string]interface{})
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+		row, _ := reader.FieldPos(0)
+
+		key := strings.TrimSpace(record[keyIndex])
+		if key == "" {
+			line, column := reader.FieldPos(keyIndex)
+			return nil, positionError(line, column, fmt.Sprintf("failed to parse CSV: empty %s", columns[keyIndex].name), nil)
+		}
+		if _, exists := result[key]; exists {
+			opts.warn("Duplicate node '%s' in CSV line %d (keeping first occurrence)", key, row)
+			continue
+		}
+
+		node := make(map[string]interface{})
+		for _, col := range columns {
+			cell := strings.TrimSpace(record[col.index])
+			if col.index == keyIndex || cell == "" {
+				continue
+			}
+
+			value, err := convertCSVCell(cell, col.hint, listSep)
+			if err != nil {
+				line, column := reader.FieldPos(col.index)
+				return nil, positionError(line, column, fmt.Sprintf("failed to parse CSV: column %s: %v", col.name, err), err)
+			}
+			setPath(node, col.path, value)
+		}
+
+		result[key] = node
+	}
+
+	return result, nil
+}
+
+// csvError locates an error reported by the CSV reader.
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return positionError(parseErr.Line, parseErr.Column, "failed to parse CSV: "+parseErr.Err.Error(), err)
+	}
+	return fmt.Errorf("failed to parse CSV: %w", err)
+}
+
+func parseCSVHeader(header []string, keyName string) ([]csvColumn, int, error) {
+	columns := make([]csvColumn, len(header))
+	keyIndex := -1
+
+	for i, raw := range header {
+		name, hint, _ := strings.Cut(strings.TrimSpace(raw), ":")
+		if hint == "" {
+			hint = "string"
+		}
+		switch hint {
+		case "string", "int", "float", "bool", "list":
+		default:
+			return nil, 0, fmt.Errorf("failed to parse CSV: unknown type hint %q for column %s", hint, name)
+		}
+		if name == "" {
+			return nil, 0, fmt.Errorf("failed to parse CSV: column %d has no name", i+1)
+		}
+
+		columns[i] = csvColumn{name: name, path: strings.Split(name, "."), hint: hint, index: i}
+		if name == keyName {
+			keyIndex = i
+		}
+	}
+
+	if keyName == "" {
+		keyIndex = 0
+	}
+	if keyIndex < 0 {
+		return nil, 0, fmt.Errorf("failed to parse CSV: key column %q not found", keyName)
+	}
+
+	return columns, keyIndex, nil
+}
+
+func convertCSVCell(cell, hint, listSep string) (interface{}, error) {
+	switch hint {
+	case "int":
+		return strconv.Atoi(cell)
+	case "float":
+		return strconv.ParseFloat(cell, 64)
+	case "bool":
+		return strconv.ParseBool(cell)
+	case "list":
+		var items []interface{}
+		for _, item := range strings.Split(cell, listSep) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	default:
+		return cell, nil
+	}
+}
+
+// setPath stores value at a dotted path, creating intermediate maps.
+func setPath(target map[string]interface{}, path []string, value interface{}) {
+	for _, field := range path[:len(path)-1] {
+		child, ok := target[field].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			target[field] = child
+		}
+		target = child
+	}
+	target[path[len(path)-1]] = value
+}
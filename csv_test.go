@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// CSV rows become nodes with typed and nested fields
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    LoadOptions
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "typed hints and nested headers",
+			data: `# rack inventory
+hostname,ip,rack.row,rack.unit:int,weight:float,monitored:bool,tags:list
+web-001,10.0.1.5,A,12,1.5,true,web; prod
+db-001,10.0.2.7,B,4,,false,
+`,
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{
+					"ip":        "10.0.1.5",
+					"rack":      map[string]interface{}{"row": "A", "unit": 12},
+					"weight":    1.5,
+					"monitored": true,
+					"tags":      []interface{}{"web", "prod"},
+				},
+				"db-001": map[string]interface{}{
+					"ip":        "10.0.2.7",
+					"rack":      map[string]interface{}{"row": "B", "unit": 4},
+					"monitored": false,
+				},
+			},
+		},
+		{
+			name: "key column and list separator",
+			data: "ip,hostname,tags:list\n10.0.1.5,web-001,web|prod\n",
+			opts: LoadOptions{CSVKey: "hostname", CSVListSep: "|"},
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"ip": "10.0.1.5", "tags": []interface{}{"web", "prod"}},
+			},
+		},
+		{
+			name: "duplicate rows keep first",
+			data: "name,ip\nweb-001,10.0.1.5\nweb-001,10.0.1.6\n",
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"ip": "10.0.1.5"},
+			},
+		},
+		{
+			name:    "invalid int",
+			data:    "name,port:int\nweb-001,http\n",
+			wantErr: "column port",
+		},
+		{
+			name:    "unknown hint",
+			data:    "name,port:number\n",
+			wantErr: `unknown type hint "number"`,
+		},
+		{
+			name:    "missing key column",
+			data:    "name,ip\n",
+			opts:    LoadOptions{CSVKey: "hostname"},
+			wantErr: `key column "hostname" not found`,
+		},
+		{
+			name:    "empty key",
+			data:    "name,ip\n,10.0.1.5\n",
+			wantErr: "empty name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tt.data), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Reserved node fields for inheritance. A node with _extends inherits every
+// field of the named nodes, merged in order beneath its own fields. A node
+// with _abstract: true can be extended but is not synced itself.
+const (
+	extendsKey  = "_extends"
+	abstractKey = "_abstract"
+)
+
+// resolveInheritance replaces every node that extends others with the
+// merged result and drops abstract definitions. It runs once all vars and
+// overlays are loaded, so parents may live in any file, and before
+// directory defaults are applied, so only fields written on a node are
+// inherited or override its parents.
+func resolveInheritance(vars map[string]interface{}, sources map[string]NodeSource, opts LoadOptions) error {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	r := &inheritance{vars: vars, sources: sources, listMode: opts.ListMerge, removals: opts.removals, resolved: make(map[string]map[string]interface{})}
+
+	inherited := 0
+	var abstract []string
+	for _, key := range keys {
+		node, ok := vars[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		isAbstract, err := abstractNode(node)
+		if err != nil {
+			return fmt.Errorf("node '%s' in %s: %w", key, sources[key].Path, err)
+		}
+
+		resolved, err := r.resolve(key, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := node[extendsKey]; ok {
+			inherited++
+			if opts.Verbose {
+				log.Printf("[DEBUG] Node %s extends %v", key, node[extendsKey])
+			}
+		}
+
+		if isAbstract {
+			abstract = append(abstract, key)
+			continue
+		}
+		vars[key] = resolved
+	}
+
+	// Drop abstract definitions only once every node has been resolved
+	for _, key := range abstract {
+		delete(vars, key)
+		delete(sources, key)
+		delete(opts.layers, key)
+		delete(opts.removals, key)
+	}
+
+	if inherited > 0 || len(abstract) > 0 {
+		log.Printf("[INFO] Resolved %d inheriting nodes, dropped %d abstract definitions", inherited, len(abstract))
+	}
+	return nil
+}
+
+type inheritance struct {
+	vars     map[string]interface{}
+	sources  map[string]NodeSource
+	listMode string
+	removals fieldRemovals
+	resolved map[string]map[string]interface{}
+}
+
+// resolve returns the fields of key with its parents merged in; chain holds
+// the nodes currently being resolved, to detect cycles.
+func (r *inheritance) resolve(key string, chain []string) (map[string]interface{}, error) {
+	if resolved, ok := r.resolved[key]; ok {
+		return resolved, nil
+	}
+
+	for i, seen := range chain {
+		if seen == key {
+			return nil, fmt.Errorf("inheritance cycle: %s", strings.Join(append(chain[i:], key), " -> "))
+		}
+	}
+
+	node := r.vars[key].(map[string]interface{})
+	parents, err := extendsParents(node[extendsKey])
+	if err != nil {
+		return nil, fmt.Errorf("node '%s' in %s: %w", key, r.sources[key].Path, err)
+	}
+
+	own := make(map[string]interface{}, len(node))
+	for field, value := range node {
+		if field != extendsKey && field != abstractKey {
+			own[field] = value
+		}
+	}
+
+	var base interface{}
+	for _, parent := range parents {
+		value, ok := r.vars[parent]
+		if !ok {
+			return nil, fmt.Errorf("node '%s' in %s extends unknown node '%s'", key, r.sources[key].Path, parent)
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("node '%s' in %s extends '%s', which is not a map", key, r.sources[key].Path, parent)
+		}
+
+		fields, err := r.resolve(parent, append(chain, key))
+		if err != nil {
+			return nil, err
+		}
+		base = deepMerge(base, fields, r.listMode)
+	}
+
+	result := own
+	if base != nil {
+		// Fields removed by an overlay are not inherited back
+		result = r.removals.strip(key, deepMerge(base, own, r.listMode).(map[string]interface{}))
+	}
+
+	r.resolved[key] = result
+	return result, nil
+}
+
+// extendsParents reads an _extends value: a node name or a list of them.
+func extendsParents(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		parents := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must list node names, got %v", extendsKey, item)
+			}
+			parents = append(parents, name)
+		}
+		return parents, nil
+	default:
+		return nil, fmt.Errorf("%s must be a node name or a list of node names, got %v", extendsKey, value)
+	}
+}
+
+func abstractNode(node map[string]interface{}) (bool, error) {
+	value, ok := node[abstractKey]
+	if !ok {
+		return false, nil
+	}
+	abstract, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be true or false, got %v", abstractKey, value)
+	}
+	return abstract, nil
+}
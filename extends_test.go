@@ -0,0 +1,139 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Parents may live in other files; abstract definitions are not synced
+func TestLoadVarsExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"vars/base.yaml": `
+base-web:
+  _abstract: true
+  port: 80
+  tags: [web]
+  meta: {owner: web, rack: r1}
+base-prod:
+  _abstract: true
+  meta: {env: prod}
+`,
+		"vars/web.yaml": `
+web-001:
+  _extends: [base-web, base-prod]
+  ip: 10.0.0.1
+  meta: {rack: r2}
+web-002:
+  _extends: web-001
+  ip: 10.0.0.2
+`,
+	})
+
+	vars, sources, err := loadVars([]string{filepath.Join(dir, "vars")}, LoadOptions{ListMerge: "replace"})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	web001 := map[string]interface{}{
+		"ip":   "10.0.0.1",
+		"port": uint64(80),
+		"tags": []interface{}{"web"},
+		"meta": map[string]interface{}{"owner": "web", "rack": "r2", "env": "prod"},
+	}
+	web002 := map[string]interface{}{
+		"ip":   "10.0.0.2",
+		"port": uint64(80),
+		"tags": []interface{}{"web"},
+		"meta": map[string]interface{}{"owner": "web", "rack": "r2", "env": "prod"},
+	}
+	want := map[string]interface{}{"web-001": web001, "web-002": web002}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+
+	if _, ok := sources["base-web"]; ok {
+		t.Error("abstract node base-web still has a source")
+	}
+}
+
+// Directory defaults go beneath inherited fields, not between child and parent
+func TestLoadVarsExtendsDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"base/_defaults.yaml": "owner: base-team\nport: 8080\n",
+		"base/web.yaml":       "base-web:\n  _abstract: true\n  port: 80\n  role: web\n",
+		"prod/_defaults.yaml": "role: generic\nenv: prod\n",
+		"prod/web.yaml":       "web-001:\n  _extends: base-web\n  ip: 10.0.0.1\n",
+	})
+
+	vars, _, err := loadVars([]string{filepath.Join(dir, "base"), filepath.Join(dir, "prod")}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{
+			"ip":   "10.0.0.1",
+			"port": uint64(80),
+			"role": "web",
+			"env":  "prod",
+		},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+}
+
+func TestLoadVarsExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		vars string
+		want string
+	}{
+		{
+			name: "unknown parent",
+			vars: "web-001:\n  _extends: base-web\n",
+			want: "extends unknown node 'base-web'",
+		},
+		{
+			name: "cycle",
+			vars: "a:\n  _extends: b\nb:\n  _extends: c\nc:\n  _extends: a\n",
+			want: "inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			name: "self",
+			vars: "a:\n  _extends: a\n",
+			want: "inheritance cycle: a -> a",
+		},
+		{
+			name: "scalar parent",
+			vars: "a: 10.0.0.1\nb:\n  _extends: a\n",
+			want: "extends 'a', which is not a map",
+		},
+		{
+			name: "bad extends",
+			vars: "a:\n  _extends: {name: b}\n",
+			want: "_extends must be a node name or a list of node names",
+		},
+		{
+			name: "bad abstract",
+			vars: "a:\n  _abstract: yes please\n",
+			want: "_abstract must be true or false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeVarsFiles(t, dir, map[string]string{"nodes.yaml": tt.vars})
+
+			_, _, err := loadVars([]string{filepath.Join(dir, "nodes.yaml")}, LoadOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadVars() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
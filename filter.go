@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the optional file in a vars directory listing exclude
+// patterns, one per line, with # comments
+const ignoreFileName = ".syncignore"
+
+// varsFilter decides which files of a vars directory are loaded. Patterns
+// are globs matched against paths relative to the directory, with forward
+// slashes:
+//
+//	*.draft.yaml   a pattern without a slash matches the base name at any depth
+//	fixtures/*     a pattern with an inner or leading slash matches the whole
+//	               relative path
+//	archive/       a trailing slash matches directories only
+//
+// A file is loaded when it matches no exclude pattern and, if include
+// patterns are given, it or one of its directories matches one of them.
+type varsFilter struct {
+	include []string
+	exclude []filterPattern
+}
+
+// filterPattern is an exclude pattern and where it was set, for logging
+type filterPattern struct {
+	pattern string
+	origin  string
+}
+
+// newVarsFilter combines the -include and -exclude patterns with the
+// ignore file of the vars directory root, if there is one.
+func newVarsFilter(root string, opts LoadOptions) (*varsFilter, error) {
+	filter := &varsFilter{}
+
+	for _, pattern := range opts.Include {
+		if err := checkFilterPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid -include pattern %q: %w", pattern, err)
+		}
+		filter.include = append(filter.include, pattern)
+	}
+
+	for _, pattern := range opts.Exclude {
+		if err := checkFilterPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid -exclude pattern %q: %w", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, filterPattern{pattern: pattern, origin: "-exclude"})
+	}
+
+	ignorePath := filepath.Join(root, ignoreFileName)
+	data, err := os.ReadFile(ignorePath)
+	if os.IsNotExist(err) {
+		return filter, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if err := checkFilterPattern(pattern); err != nil {
+			return nil, withSource(ignorePath, data, positionError(lineNum, 1, fmt.Sprintf("invalid pattern %q", pattern), err))
+		}
+		filter.exclude = append(filter.exclude, filterPattern{pattern: pattern, origin: fmt.Sprintf("%s:%d", ignoreFileName, lineNum)})
+	}
+
+	return filter, nil
+}
+
+// excluded reports whether rel matches an exclude pattern, and which one
+func (f *varsFilter) excluded(rel string, isDir bool) (string, bool) {
+	for _, p := range f.exclude {
+		if matchFilter(p.pattern, rel, isDir) {
+			return p.origin + " " + p.pattern, true
+		}
+	}
+	return "", false
+}
+
+// included reports whether the file rel, or one of its directories, matches
+// an include pattern. Without include patterns every file is included.
+func (f *varsFilter) included(rel string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.include {
+		if matchFilter(pattern, rel, false) {
+			return true
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if matchFilter(pattern, dir, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchFilter(pattern, rel string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	target := rel
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(rel)
+	}
+	matched, _ := path.Match(strings.TrimPrefix(pattern, "/"), target)
+	return matched
+}
+
+func checkFilterPattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	return err
+}
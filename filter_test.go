@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMatchFilter(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{pattern: "*.draft.yaml", rel: "web/web-001.draft.yaml", want: true},
+		{pattern: "*.draft.yaml", rel: "web/web-001.yaml", want: false},
+		{pattern: "archive/", rel: "prod/archive", isDir: true, want: true},
+		{pattern: "archive/", rel: "prod/archive", isDir: false, want: false},
+		{pattern: "archive", rel: "prod/archive", isDir: true, want: true},
+		{pattern: "fixtures/*.yaml", rel: "fixtures/a.yaml", want: true},
+		{pattern: "fixtures/*.yaml", rel: "test/fixtures/a.yaml", want: false},
+		{pattern: "/prod", rel: "prod", isDir: true, want: true},
+		{pattern: "fixtures/", rel: "test/fixtures", isDir: true, want: true},
+		{pattern: "/fixtures/", rel: "test/fixtures", isDir: true, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchFilter(tt.pattern, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("matchFilter(%q, %q, %v) = %v, want %v", tt.pattern, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// -include, -exclude and the ignore file are applied during the walk
+func TestLoadVarsFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"prod/web.yaml":           "web-001: {ip: 10.0.0.1}\n",
+		"prod/web.draft.yaml":     "web-002: {ip: 10.0.0.2}\n",
+		"prod/archive/old.yaml":   "web-003: {ip: 10.0.0.3}\n",
+		"staging/web.yaml":        "web-101: {ip: 10.1.0.1}\n",
+		"fixtures/broken.yaml":    "web-201: {ip: 10.2.0.1}\n",
+		"test/fixtures/keep.yaml": "web-301: {ip: 10.3.0.1}\n",
+		".syncignore":             "# test data\n/fixtures/\n\n*.draft.yaml\n",
+	})
+
+	tests := []struct {
+		name string
+		opts LoadOptions
+		want []string
+	}{
+		{
+			name: "ignore file",
+			want: []string{"web-001", "web-003", "web-101", "web-301"},
+		},
+		{
+			name: "exclude",
+			opts: LoadOptions{Exclude: []string{"archive/", "staging/web.yaml"}},
+			want: []string{"web-001", "web-301"},
+		},
+		{
+			name: "include",
+			opts: LoadOptions{Include: []string{"prod/"}},
+			want: []string{"web-001", "web-003"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, _, err := loadVars([]string{dir}, tt.opts)
+			if err != nil {
+				t.Fatalf("loadVars() error = %v", err)
+			}
+			var got []string
+			for key := range vars {
+				got = append(got, key)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("loaded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadVarsFilterErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{"web.yaml": "web-001: {ip: 10.0.0.1}\n"})
+
+	_, _, err := loadVars([]string{dir}, LoadOptions{Exclude: []string{"[web"}})
+	if err == nil || !strings.Contains(err.Error(), `invalid -exclude pattern "[web"`) {
+		t.Errorf("loadVars() error = %v, want invalid -exclude pattern", err)
+	}
+
+	writeVarsFiles(t, dir, map[string]string{ignoreFileName: "archive/\n[web\n"})
+	_, _, err = loadVars([]string{dir}, LoadOptions{})
+	want := filepath.Join(dir, ignoreFileName) + `:2:1: invalid pattern "[web"`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("loadVars() error = %v, want %q", err, want)
+	}
+}
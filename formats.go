@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// varsExtensions maps file extensions to the vars format they are parsed as
+var varsExtensions = map[string]string{
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".json": "json",
+	".toml": "toml",
+	".hcl":  "hcl",
+	".csv":  "csv",
+}
+
+// isVarsFormat reports whether format names a supported vars format.
+func isVarsFormat(format string) bool {
+	for _, f := range varsExtensions {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// detectVarsFormat returns the format to parse path with: the forced format
+// when set, otherwise the one implied by the file extension ("" if none).
+func detectVarsFormat(path, forced string) string {
+	if forced != "" {
+		return forced
+	}
+	return varsExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// loadVarsFile loads a single vars file in the given format; parse errors
+// carry the file path and, where known, the line and column.
+func loadVarsFile(path, format string, opts LoadOptions) (map[string]interface{}, error) {
+	if format == "yaml" {
+		return loadYAMLFile(path, opts)
+	}
+	if format == "" {
+		return nil, fmt.Errorf("cannot detect vars format of %s (use -vars-format)", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	vars, err := parseVars(data, format, opts)
+	if err != nil {
+		return nil, withSource(path, data, err)
+	}
+	return vars, nil
+}
+
+// parseVars parses vars data in the given format and selects the node map
+// inside it. Errors are located with positionError where the parser
+// reports a position.
+func parseVars(data []byte, format string, opts LoadOptions) (map[string]interface{}, error) {
+	switch format {
+	case "yaml":
+		return parseYAML(data, opts)
+	case "csv":
+		return parseCSV(data, opts)
+	}
+
+	doc, err := decodeVars(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return selectNodes(doc, opts)
+}
+
+// decodeVars decodes a JSON, TOML or HCL document as is
+func decodeVars(data []byte, format string) (interface{}, error) {
+	switch format {
+	case "json":
+		return parseJSON(data)
+	case "toml":
+		return parseTOML(data)
+	case "hcl":
+		return parseHCL(data)
+	default:
+		return nil, fmt.Errorf("unknown vars format: %s", format)
+	}
+}
+
+// selectNodes returns the node map inside a decoded vars document: the
+// value at opts.Root, which is either a map of node name to node data or a
+// list of objects named by their opts.ListKey field.
+func selectNodes(doc interface{}, opts LoadOptions) (map[string]interface{}, error) {
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	if opts.Root != "" {
+		top, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("vars root %q not found: top level is not a map", opts.Root)
+		}
+		if doc, ok = lookupPath(top, strings.Split(opts.Root, ".")); !ok {
+			return nil, fmt.Errorf("vars root %q not found", opts.Root)
+		}
+	}
+
+	switch nodes := doc.(type) {
+	case map[string]interface{}:
+		return nodes, nil
+	case []interface{}:
+		return listToNodes(nodes, opts)
+	case nil:
+		return map[string]interface{}{}, nil
+	default:
+		return nil, fmt.Errorf("nodes must be a map or a list, got %T", doc)
+	}
+}
+
+// listToNodes keys a list of objects by their opts.ListKey field (dotted
+// paths allowed); the field stays in the node data.
+func listToNodes(items []interface{}, opts LoadOptions) (map[string]interface{}, error) {
+	if opts.ListKey == "" {
+		return nil, fmt.Errorf("nodes are a list (set -vars-list-key)")
+	}
+
+	nodes := make(map[string]interface{}, len(items))
+	for i, item := range items {
+		node, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("list item %d is not a map", i)
+		}
+
+		value, ok := lookupPath(node, strings.Split(opts.ListKey, "."))
+		if !ok || value == nil || fmt.Sprint(value) == "" {
+			return nil, fmt.Errorf("list item %d has no %s field", i, opts.ListKey)
+		}
+
+		key := fmt.Sprint(value)
+		if _, exists := nodes[key]; exists {
+			opts.warn("Duplicate node '%s' in list item %d (keeping first occurrence)", key, i)
+			continue
+		}
+		nodes[key] = node
+	}
+
+	return nodes, nil
+}
+
+// sniffVarsFormat guesses the format of data without a file name by trying
+// each parser in turn, from the strictest syntax to the most lenient. CSV
+// accepts nearly anything, so it must always be requested explicitly.
+func sniffVarsFormat(data []byte) (string, error) {
+	for _, format := range []string{"json", "yaml", "toml", "hcl"} {
+		// Decode only: node selection and duplicates are handled once the
+		// format is known
+		var docs []interface{}
+		var err error
+		if format == "yaml" {
+			docs, err = parseYAMLDocuments(data, nil)
+		} else {
+			var doc interface{}
+			doc, err = decodeVars(data, format)
+			docs = []interface{}{doc}
+		}
+		if err == nil && isStructured(docs) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("cannot detect vars format (use -vars-format)")
+}
+
+// isStructured reports whether every document is a map or a list; plain
+// text decodes as a YAML string.
+func isStructured(docs []interface{}) bool {
+	for _, doc := range docs {
+		switch doc.(type) {
+		case map[string]interface{}, []interface{}:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseJSON rejects repeated object keys, which json.Unmarshal silently
+// resolves by keeping the last one, as YAML does.
+func parseJSON(data []byte) (interface{}, error) {
+	var result interface{}
+	err := json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, jsonError(data, "failed to parse JSON", err)
+	}
+
+	if err := checkJSONKeys(json.NewDecoder(bytes.NewReader(data)), data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkJSONKeys walks the next value of valid JSON token by token and
+// reports the first object key defined twice.
+func checkJSONKeys(decoder *json.Decoder, data []byte) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		keys := make(map[string]int64)
+		for decoder.More() {
+			start := jsonTokenStart(data, decoder.InputOffset())
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			if previous, exists := keys[key]; exists {
+				line, column := offsetPosition(data, start)
+				previousLine, previousColumn := offsetPosition(data, previous)
+				return positionError(line, column, fmt.Sprintf("failed to parse JSON: key %q already defined at [%d:%d]", key, previousLine, previousColumn), nil)
+			}
+			keys[key] = start
+
+			if err := checkJSONKeys(decoder, data); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for decoder.More() {
+			if err := checkJSONKeys(decoder, data); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	_, err = decoder.Token() // Closing delimiter
+	return err
+}
+
+// jsonTokenStart skips the whitespace and separators at offset, returning
+// the offset of the token that follows.
+func jsonTokenStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// jsonError locates an encoding/json error at the offset it reports.
+func jsonError(data []byte, prefix string, err error) error {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+	if offset < 0 {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+
+	line, column := offsetPosition(data, offset)
+	return positionError(line, column, prefix+": "+err.Error(), err)
+}
+
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := toml.Unmarshal(data, &result)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, positionError(parseErr.Position.Line, parseErr.Position.Col, "failed to parse TOML: "+parseErr.Message, err)
+		}
+		return nil, fmt.Errorf("failed to parse TOML: %w", err)
+	}
+
+	// Arrays of tables decode as []map[string]interface{}, which foreach
+	// would not recognise as a list
+	return normalizeValue(result).(map[string]interface{}), nil
+}
+
+// normalizeValue converts typed slices and maps into the generic
+// []interface{} / map[string]interface{} shapes the YAML loader produces.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeValue(item)
+		}
+		return items
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// parseHCL converts the syntax tree directly because decoding into
+// interface{} turns every object into a list of maps.
+func parseHCL(data []byte) (map[string]interface{}, error) {
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		var posErr *parser.PosError
+		if errors.As(err, &posErr) {
+			return nil, positionError(posErr.Pos.Line, posErr.Pos.Column, "failed to parse HCL: "+posErr.Err.Error(), err)
+		}
+		return nil, fmt.Errorf("failed to parse HCL: %w", err)
+	}
+
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse HCL: top level is not an object")
+	}
+
+	return hclObject(list)
+}
+
+// hclObject converts an object list; blocks with several labels such as
+// `service "web" { ... }` become nested maps. Setting the same key twice is
+// a parse error, as it is in YAML, except that blocks sharing their leading
+// labels are merged.
+func hclObject(list *ast.ObjectList) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	defined := make(map[string]token.Pos)
+
+	for _, item := range list.Items {
+		value, err := hclValue(item.Val)
+		if err != nil {
+			return nil, err
+		}
+
+		target := result
+		var path []string
+		for i, key := range item.Keys {
+			name := fmt.Sprint(key.Token.Value())
+			path = append(path, name)
+			id := strings.Join(path, "\x00")
+
+			child, isBlock := target[name].(map[string]interface{})
+			last := i == len(item.Keys)-1
+			if previous, exists := defined[id]; exists && (last || !isBlock) {
+				return nil, positionError(key.Pos().Line, key.Pos().Column, fmt.Sprintf("failed to parse HCL: key %q already defined at [%d:%d]", strings.Join(path, "."), previous.Line, previous.Column), nil)
+			}
+			if last {
+				target[name] = value
+				defined[id] = key.Pos()
+				break
+			}
+			if !isBlock {
+				child = make(map[string]interface{})
+				target[name] = child
+				defined[id] = key.Pos()
+			}
+			target = child
+		}
+	}
+
+	return result, nil
+}
+
+func hclValue(node ast.Node) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.LiteralType:
+		return n.Token.Value(), nil
+	case *ast.ListType:
+		items := make([]interface{}, 0, len(n.List))
+		for _, elem := range n.List {
+			value, err := hclValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case *ast.ObjectType:
+		return hclObject(n.List)
+	default:
+		return nil, fmt.Errorf("unsupported HCL value at %s", node.Pos())
+	}
+}
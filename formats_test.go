@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Every vars format yields the same node map shape
+func TestLoadVarsFileFormats(t *testing.T) {
+	files := map[string]string{
+		"nodes.yaml": `
+web-001:
+  ip: 10.0.0.1
+  ports:
+    - name: http
+      port: 80
+`,
+		"nodes.json": `{"web-001": {"ip": "10.0.0.1", "ports": [{"name": "http", "port": 80}]}}`,
+		"nodes.toml": `
+[web-001]
+ip = "10.0.0.1"
+
+[[web-001.ports]]
+name = "http"
+port = 80
+`,
+		"nodes.hcl": `
+web-001 {
+  ip = "10.0.0.1"
+  ports = [{ name = "http", port = 80 }]
+}
+`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			vars, err := loadVarsFile(path, detectVarsFormat(path, ""), LoadOptions{})
+			if err != nil {
+				t.Fatalf("loadVarsFile() error = %v", err)
+			}
+
+			node, ok := vars["web-001"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("web-001 is %T, want map", vars["web-001"])
+			}
+			if node["ip"] != "10.0.0.1" {
+				t.Errorf("ip = %v, want 10.0.0.1", node["ip"])
+			}
+
+			items, err := evaluateForeach("{{ .Value.ports }}", ExecutionContext{Value: node})
+			if err != nil {
+				t.Fatalf("evaluateForeach() error = %v", err)
+			}
+			if len(items) != 1 {
+				t.Fatalf("ports has %d items, want 1", len(items))
+			}
+
+			port, err := processTemplate("{{ .Item.port }}", ExecutionContext{Item: items[0]})
+			if err != nil || !reflect.DeepEqual(port, 80) {
+				t.Errorf("port = %v (%v), want 80", port, err)
+			}
+		})
+	}
+}
+
+func TestDetectVarsFormat(t *testing.T) {
+	tests := []struct {
+		path   string
+		forced string
+		want   string
+	}{
+		{path: "a.yml", want: "yaml"},
+		{path: "a.JSON", want: "json"},
+		{path: "a.tf.hcl", want: "hcl"},
+		{path: "inventory.out", want: ""},
+		{path: "inventory.out", forced: "json", want: "json"},
+	}
+
+	for _, tt := range tests {
+		if got := detectVarsFormat(tt.path, tt.forced); got != tt.want {
+			t.Errorf("detectVarsFormat(%q, %q) = %q, want %q", tt.path, tt.forced, got, tt.want)
+		}
+	}
+}
+
+// Format detection for stdin input
+func TestSniffVarsFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "json", data: `{"web-001": {"ip": "10.0.0.1"}}`, want: "json"},
+		{name: "yaml", data: "web-001:\n  ip: 10.0.0.1\n", want: "yaml"},
+		{name: "yaml flow map", data: "{web-001: {ip: 10.0.0.1}}", want: "yaml"},
+		{name: "toml", data: "[web-001]\nip = \"10.0.0.1\"\n", want: "toml"},
+		{name: "hcl", data: "web-001 {\n  ip = \"10.0.0.1\"\n}\n", want: "hcl"},
+		{name: "json list", data: `[{"name": "web-001"}]`, want: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sniffVarsFormat([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("sniffVarsFormat() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sniffVarsFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Nodes nested under a root or given as a list of objects
+func TestParseVarsRoot(t *testing.T) {
+	web := map[string]interface{}{"hostname": "web-001", "ip": "10.0.0.1"}
+
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		opts    LoadOptions
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:   "yaml map under root",
+			format: "yaml",
+			data:   "all:\n  children:\n    web:\n      hosts:\n        web-001:\n          ip: 10.0.0.1\n",
+			opts:   LoadOptions{Root: "all.children.web.hosts"},
+			want:   map[string]interface{}{"web-001": map[string]interface{}{"ip": "10.0.0.1"}},
+		},
+		{
+			name:   "json list at top level",
+			format: "json",
+			data:   `[{"hostname": "web-001", "ip": "10.0.0.1"}]`,
+			opts:   LoadOptions{ListKey: "hostname"},
+			want:   map[string]interface{}{"web-001": web},
+		},
+		{
+			name:   "toml list under root",
+			format: "toml",
+			data:   "[[hosts]]\nhostname = \"web-001\"\nip = \"10.0.0.1\"\n",
+			opts:   LoadOptions{Root: "hosts", ListKey: "hostname"},
+			want:   map[string]interface{}{"web-001": web},
+		},
+		{
+			name:   "yaml documents each under root",
+			format: "yaml",
+			data:   "hosts:\n  - {hostname: web-001, ip: 10.0.0.1}\n---\nhosts:\n  - {hostname: web-002}\n",
+			opts:   LoadOptions{Root: "hosts", ListKey: "hostname"},
+			want: map[string]interface{}{
+				"web-001": web,
+				"web-002": map[string]interface{}{"hostname": "web-002"},
+			},
+		},
+		{
+			name:    "missing root",
+			format:  "yaml",
+			data:    "hosts: {}\n",
+			opts:    LoadOptions{Root: "all.hosts"},
+			wantErr: `vars root "all.hosts" not found`,
+		},
+		{
+			name:    "list without key field",
+			format:  "json",
+			data:    `[{"ip": "10.0.0.1"}]`,
+			opts:    LoadOptions{ListKey: "hostname"},
+			wantErr: "list item 0 has no hostname field",
+		},
+		{
+			name:    "list without key option",
+			format:  "json",
+			data:    `[{"ip": "10.0.0.1"}]`,
+			wantErr: "set -vars-list-key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVars([]byte(tt.data), tt.format, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVars() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Keys set twice in one file are parse errors in every format, instead of
+// silently losing the first definition
+func TestParseVarsDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "yaml node",
+			format:  "yaml",
+			data:    "web-001:\n  ip: 10.0.0.1\nweb-001:\n  env: prod\n",
+			wantErr: `mapping key "web-001" already defined`,
+		},
+		{
+			name:    "json node",
+			format:  "json",
+			data:    "{\n  \"web-001\": {\"ip\": \"10.0.0.1\"},\n  \"web-001\": {\"env\": \"prod\"}\n}\n",
+			wantErr: `3:3: failed to parse JSON: key "web-001" already defined at [2:3]`,
+		},
+		{
+			name:    "json nested field",
+			format:  "json",
+			data:    `[{"name": "web-001", "meta": {"rack": "r1", "rack": "r2"}}]`,
+			wantErr: `1:45: failed to parse JSON: key "rack" already defined at [1:31]`,
+		},
+		{
+			name:    "hcl node",
+			format:  "hcl",
+			data:    "\"web-001\" {\n  ip = \"10.0.0.1\"\n}\n\"web-001\" {\n  env = \"prod\"\n}\n",
+			wantErr: `4:1: failed to parse HCL: key "web-001" already defined at [1:1]`,
+		},
+		{
+			name:    "hcl field",
+			format:  "hcl",
+			data:    "web-001 {\n  ip = \"10.0.0.1\"\n  ip = \"10.0.0.2\"\n}\n",
+			wantErr: `3:3: failed to parse HCL: key "ip" already defined at [2:3]`,
+		},
+		{
+			name:    "hcl labelled block",
+			format:  "hcl",
+			data:    "web-001 service \"http\" {\n  port = 80\n}\nweb-001 service \"http\" {\n  port = 8080\n}\n",
+			wantErr: `4:17: failed to parse HCL: key "web-001.service.http" already defined at [1:17]`,
+		},
+		{
+			name:   "hcl blocks sharing labels",
+			format: "hcl",
+			data:   "web-001 service \"http\" {\n  port = 80\n}\nweb-001 service \"https\" {\n  port = 443\n}\n",
+			want: map[string]interface{}{"web-001": map[string]interface{}{"service": map[string]interface{}{
+				"http":  map[string]interface{}{"port": int64(80)},
+				"https": map[string]interface{}{"port": int64(443)},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVars([]byte(tt.data), tt.format, LoadOptions{ListKey: "name"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVars() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// loadGit loads vars from a path as it was at a revision of the local git
+// repository, given as REV:path. Paths are relative to the current
+// directory, as for other -vars paths. The whole tree of the commit is
+// exported to a temporary directory, so YAML tags may reference files
+// outside path, and path is loaded like a file or directory there; the
+// working copy is never touched. Node sources, warnings and errors name the revision
+// instead of the temporary copy, e.g. HEAD~1:inventory/web.yaml.
+func loadGit(target, root string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	rev, rel, ok := strings.Cut(target, ":")
+	if !ok || rev == "" {
+		return fmt.Errorf("invalid git source %q (expected git:REV:path)", root)
+	}
+
+	topLevel, err := runGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("not in a git repository: %w", err)
+	}
+	prefix, err := runGit("", "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+
+	commit, err := runGit(topLevel, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("unknown git revision %s", rev)
+	}
+
+	treePath := path.Join(prefix, filepath.ToSlash(rel))
+	if treePath == ".." || strings.HasPrefix(treePath, "../") {
+		return fmt.Errorf("git path %s is outside the repository", rel)
+	}
+	if treePath == "." {
+		treePath = ""
+	}
+
+	if _, err := runGit(topLevel, "cat-file", "-e", commit+":"+treePath); err != nil {
+		return fmt.Errorf("path %s does not exist at %s", rel, rev)
+	}
+
+	log.Printf("[INFO] Loading vars from git: %s at %s (commit %.12s)", rel, rev, commit)
+
+	dir, err := os.MkdirTemp("", binaryName+"-git-")
+	if err != nil {
+		return fmt.Errorf("failed to create git snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := exportGitTree(topLevel, commit, dir); err != nil {
+		return err
+	}
+	if opts.Verbose {
+		log.Printf("[DEBUG] Exported %s to %s", rev, dir)
+	}
+
+	opts.rename = strings.NewReplacer(dir+string(filepath.Separator), rev+":", dir, rev+":")
+	if err := loadVarsEntry(filepath.Join(dir, filepath.FromSlash(treePath)), root, opts, allVars, sources); err != nil {
+		return &renamedError{err: err, rename: opts.rename}
+	}
+
+	// Point sources at the revision instead of the temporary copy
+	for key, source := range sources {
+		if strings.HasPrefix(source.Path, dir+string(filepath.Separator)) {
+			source.Path = filepath.ToSlash(opts.rename.Replace(source.Path))
+			sources[key] = source
+		}
+	}
+
+	return nil
+}
+
+// renamedError is an error whose message names the source of a temporary
+// copy instead of the copy itself.
+type renamedError struct {
+	err    error
+	rename *strings.Replacer
+}
+
+func (e *renamedError) Error() string {
+	return e.rename.Replace(e.err.Error())
+}
+
+func (e *renamedError) Unwrap() error {
+	return e.err
+}
+
+// exportGitTree writes every file of commit into dir, keeping their paths
+// relative to the repository root. The tree is listed
+// with git ls-tree and read with git cat-file, so every committed file is
+// exported as is, whatever .gitattributes says. Symlinks and submodules are
+// skipped.
+func exportGitTree(topLevel, commit, dir string) error {
+	listing, err := runGit(topLevel, "ls-tree", "-r", "-z", "--full-tree", commit)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = topLevel
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run git: %w", err)
+	}
+
+	exportErr := exportGitBlobs(listing, bufio.NewReader(stdout), stdin, dir)
+	stdin.Close()
+	io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil && exportErr == nil {
+		return fmt.Errorf("git cat-file failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return exportErr
+}
+
+// exportGitBlobs writes every regular file of an ls-tree -z listing into
+// dir, asking a running git cat-file --batch for one object at a time.
+func exportGitBlobs(listing string, batch *bufio.Reader, requests io.Writer, dir string) error {
+	for _, entry := range strings.Split(listing, "\x00") {
+		if entry == "" {
+			continue
+		}
+
+		// <mode> SP <type> SP <object> TAB <path>
+		info, name, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return fmt.Errorf("unexpected git ls-tree entry %q", entry)
+		}
+		if fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+
+		target := filepath.FromSlash(name)
+		if !filepath.IsLocal(target) {
+			return fmt.Errorf("unsafe path %s in git tree", name)
+		}
+
+		if _, err := fmt.Fprintf(requests, "%s\n", fields[2]); err != nil {
+			return fmt.Errorf("failed to read %s from git: %w", name, err)
+		}
+		header, err := batch.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read %s from git: %w", name, err)
+		}
+		// <object> SP <type> SP <size> LF <contents> LF
+		var object, typ string
+		var size int64
+		if _, err := fmt.Sscanf(header, "%s %s %d", &object, &typ, &size); err != nil {
+			return fmt.Errorf("failed to read %s from git: %s", name, strings.TrimSpace(header))
+		}
+
+		out := filepath.Join(dir, target)
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(file, batch, size)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			_, err = batch.Discard(1) // Trailing LF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// runGit runs a git command in dir ("" for the current directory) and
+// returns its trimmed output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
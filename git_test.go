@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gitCommit commits every file in dir, creating the repository if needed
+func gitCommit(t *testing.T, dir, message string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", message},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+}
+
+// Vars are read from a revision, not from the working copy
+func TestLoadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"inventory/vars/web.yaml":            "web-001:\n  ip: 10.0.0.1\n",
+		"inventory/vars/prod/_defaults.yaml": "env: prod\n",
+		"inventory/vars/prod/db.yaml":        "db-001:\n  ip: 10.0.1.1\n",
+	})
+	gitCommit(t, dir, "first")
+
+	writeVarsFiles(t, dir, map[string]string{"inventory/vars/web.yaml": "web-001:\n  ip: 10.0.0.2\n"})
+	gitCommit(t, dir, "second")
+
+	// Uncommitted changes are ignored
+	writeVarsFiles(t, dir, map[string]string{"inventory/vars/web.yaml": "web-001:\n  ip: 10.0.0.3\n"})
+	if err := os.Remove(filepath.Join(dir, "inventory/vars/prod/db.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paths are relative to the current directory inside the repository
+	t.Chdir(filepath.Join(dir, "inventory"))
+
+	vars, sources, err := loadVars([]string{"git:HEAD~1:vars"}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{"ip": "10.0.0.1"},
+		"db-001":  map[string]interface{}{"ip": "10.0.1.1", "env": "prod"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+
+	wantSource := NodeSource{Root: "git:HEAD~1:vars", Path: "HEAD~1:inventory/vars/prod/db.yaml", Rel: filepath.Join("prod", "db.yaml")}
+	if sources["db-001"] != wantSource {
+		t.Errorf("db-001 source = %+v, want %+v", sources["db-001"], wantSource)
+	}
+
+	vars, _, err = loadVars([]string{"git:HEAD:vars/web.yaml"}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() single file error = %v", err)
+	}
+	if ip := vars["web-001"].(map[string]interface{})["ip"]; ip != "10.0.0.2" {
+		t.Errorf("web-001 ip at HEAD = %v, want 10.0.0.2", ip)
+	}
+
+	for source, wantErr := range map[string]string{
+		"git:HEAD":             "expected git:REV:path",
+		"git:no-such-rev:vars": "unknown git revision no-such-rev",
+		"git:HEAD:missing":     "path missing does not exist at HEAD",
+		"git:HEAD:../../x":     "outside the repository",
+	} {
+		if _, _, err := loadVars([]string{source}, LoadOptions{}); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("loadVars(%s) error = %v, want %q", source, err, wantErr)
+		}
+	}
+}
+
+// export-ignore does not hide files, and errors name the revision rather
+// than the temporary copy
+func TestLoadGitExportAndErrors(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		".gitattributes":    "inv/ok.yaml export-ignore\ninv/subst.yaml export-subst\n",
+		"inv/ok.yaml":       "web-001:\n  ip: 10.0.0.1\n",
+		"inv/subst.yaml":    "web-002:\n  commit: $Format:%H$\n",
+		"bad/broken.yaml":   "web-003:\n  ip: [10.0.0.3\n",
+		"bad/good.yaml":     "web-004:\n  ip: 10.0.0.4\n",
+		"single/only.yaml":  "web-005: [\n",
+		"tags/web.yaml":     "web-006:\n  ports: !include ../shared/ports.yaml\n  note: !file ../shared/note.txt\n",
+		"shared/ports.yaml": "[80, 443]\n",
+		"shared/note.txt":   "hello\n",
+	})
+	gitCommit(t, dir, "first")
+	t.Chdir(dir)
+
+	vars, _, err := loadVars([]string{"git:HEAD:inv"}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{"ip": "10.0.0.1"},
+		"web-002": map[string]interface{}{"commit": "$Format:%H$"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+
+	// Tags may reference files outside the loaded path, and the log names
+	// the revision rather than the temporary copy
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	vars, _, err = loadVars([]string{"git:HEAD:tags"}, LoadOptions{})
+	log.SetOutput(output)
+	if err != nil {
+		t.Fatalf("loadVars() with tags error = %v", err)
+	}
+	want = map[string]interface{}{
+		"web-006": map[string]interface{}{"ports": []interface{}{uint64(80), uint64(443)}, "note": "hello"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+	if !strings.Contains(logs.String(), "Loading vars from directory: HEAD:tags") || strings.Contains(logs.String(), os.TempDir()) {
+		t.Errorf("log does not name the revision:\n%s", logs.String())
+	}
+
+	tests := []struct {
+		source string
+		opts   LoadOptions
+		want   string
+	}{
+		{source: "git:HEAD:bad", opts: LoadOptions{Strict: true}, want: "Skipping vars file: HEAD:bad/broken.yaml:2:"},
+		{source: "git:HEAD:single/only.yaml", want: "HEAD:single/only.yaml:"},
+	}
+	for _, tt := range tests {
+		_, _, err := loadVars([]string{tt.source}, tt.opts)
+		if err == nil {
+			t.Fatalf("loadVars(%s) succeeded, want error", tt.source)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadVars(%s) error = %v, want %q", tt.source, err, tt.want)
+		}
+		if strings.Contains(err.Error(), os.TempDir()) {
+			t.Errorf("loadVars(%s) error names the temporary copy: %v", tt.source, err)
+		}
+	}
+}
@@ -2,4 +2,8 @@ module github.com/zinrai/consul-catalog-sync
 
 go 1.24.0
 
-require github.com/goccy/go-yaml v1.19.2
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/goccy/go-yaml v1.19.2
+	github.com/hashicorp/hcl v1.0.0
+)
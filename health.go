@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const healthPollInterval = 2 * time.Second
+
+// checkSeverity orders Consul health states from best to worst so a wait
+// target of "warning" also accepts "passing".
+var checkSeverity = map[string]int{
+	"passing":  0,
+	"warning":  1,
+	"critical": 2,
+}
+
+// HealthCheck represents a single entry from the Consul Health API
+type HealthCheck struct {
+	Node        string `json:"Node"`
+	CheckID     string `json:"CheckID"`
+	Name        string `json:"Name"`
+	Status      string `json:"Status"`
+	Output      string `json:"Output"`
+	ServiceID   string `json:"ServiceID"`
+	ServiceName string `json:"ServiceName"`
+}
+
+// healthTargets lists what a run touched, grouped by node: the services whose
+// checks must pass and the checks registered directly.
+type healthTargets map[string]*nodeTargets
+
+type nodeTargets struct {
+	Services map[string]bool
+	Checks   map[string]bool
+}
+
+// WaitForHealthy polls the Health API until every check touched by the
+// operations reaches the wanted status or the timeout expires.
+func WaitForHealthy(consulAddr, datacenter string, operations []map[string]interface{}, status string, timeout time.Duration, verbose bool) error {
+	wanted, ok := checkSeverity[status]
+	if !ok {
+		return fmt.Errorf("unknown health status %q (expected passing, warning or critical)", status)
+	}
+
+	targets := collectHealthTargets(operations)
+	if len(targets) == 0 {
+		log.Printf("[INFO] No services or checks to wait for")
+		return nil
+	}
+
+	client := &http.Client{
+		Timeout: defaultTimeout,
+	}
+
+	log.Printf("[INFO] Waiting up to %s for checks on %d nodes to reach %s", timeout, len(targets), status)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		pending, total, err := pendingChecks(client, consulAddr, datacenter, targets, wanted)
+		if err != nil {
+			return err
+		}
+
+		if len(pending) == 0 {
+			log.Printf("[OK] All %d checks are %s", total, status)
+			return nil
+		}
+
+		log.Printf("[INFO] %d/%d checks not yet %s", len(pending), total, status)
+		for _, line := range pending {
+			log.Printf("[WAIT] %s", line)
+		}
+
+		if time.Now().Add(healthPollInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s with %d checks not %s", timeout, len(pending), status)
+		}
+
+		if verbose {
+			log.Printf("[DEBUG] Next health poll in %s", healthPollInterval)
+		}
+		time.Sleep(healthPollInterval)
+	}
+}
+
+// collectHealthTargets extracts the services and checks set by the operations.
+// Deletions are ignored since there is nothing left to become healthy.
+func collectHealthTargets(operations []map[string]interface{}) healthTargets {
+	targets := healthTargets{}
+
+	add := func(node string) *nodeTargets {
+		if targets[node] == nil {
+			targets[node] = &nodeTargets{
+				Services: map[string]bool{},
+				Checks:   map[string]bool{},
+			}
+		}
+		return targets[node]
+	}
+
+	for _, op := range operations {
+		if svcOp, ok := op["Service"].(map[string]interface{}); ok {
+			if verb, _ := svcOp["Verb"].(string); isDeleteVerb(verb) {
+				continue
+			}
+			node, _ := svcOp["Node"].(string)
+			service, _ := svcOp["Service"].(map[string]interface{})
+			if id := serviceID(service); node != "" && id != "" {
+				add(node).Services[id] = true
+			}
+		}
+
+		if checkOp, ok := op["Check"].(map[string]interface{}); ok {
+			if verb, _ := checkOp["Verb"].(string); isDeleteVerb(verb) {
+				continue
+			}
+			node, _ := checkOp["Node"].(string)
+			check, _ := checkOp["Check"].(map[string]interface{})
+			if id := checkID(check); node != "" && id != "" {
+				add(node).Checks[id] = true
+			}
+		}
+	}
+
+	return targets
+}
+
+// serviceID mirrors Consul's default of using the service name as its ID.
+func serviceID(service map[string]interface{}) string {
+	if id, _ := service["ID"].(string); id != "" {
+		return id
+	}
+	name, _ := service["Service"].(string)
+	return name
+}
+
+// checkID mirrors Consul's default of using the check name as its ID.
+func checkID(check map[string]interface{}) string {
+	if id, _ := check["CheckID"].(string); id != "" {
+		return id
+	}
+	name, _ := check["Name"].(string)
+	return name
+}
+
+// pendingChecks returns a description of every targeted check that has not
+// reached the wanted severity, along with the number of checks considered.
+func pendingChecks(client *http.Client, consulAddr, datacenter string, targets healthTargets, wanted int) ([]string, int, error) {
+	nodes := make([]string, 0, len(targets))
+	for node := range targets {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	var pending []string
+	total := 0
+
+	for _, node := range nodes {
+		checks, err := fetchNodeHealth(client, consulAddr, datacenter, node)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		lines, count := evaluateNodeHealth(node, targets[node], checks, wanted)
+		pending = append(pending, lines...)
+		total += count
+	}
+
+	return pending, total, nil
+}
+
+// evaluateNodeHealth matches a node's checks against its targets. Explicitly
+// registered checks that do not show up yet are reported as missing.
+func evaluateNodeHealth(node string, target *nodeTargets, checks []HealthCheck, wanted int) ([]string, int) {
+	var pending []string
+	total := 0
+	seen := map[string]bool{}
+
+	for _, check := range checks {
+		if !target.Checks[check.CheckID] && !target.Services[check.ServiceID] {
+			continue
+		}
+		seen[check.CheckID] = true
+		total++
+
+		severity, ok := checkSeverity[check.Status]
+		if ok && severity <= wanted {
+			continue
+		}
+
+		line := fmt.Sprintf("%s/%s: %s", node, check.CheckID, check.Status)
+		if output := strings.TrimSpace(check.Output); output != "" {
+			line += " (" + output + ")"
+		}
+		pending = append(pending, line)
+	}
+
+	for id := range target.Checks {
+		if !seen[id] {
+			total++
+			pending = append(pending, fmt.Sprintf("%s/%s: missing", node, id))
+		}
+	}
+
+	sort.Strings(pending)
+	return pending, total
+}
+
+func fetchNodeHealth(client *http.Client, consulAddr, datacenter, node string) ([]HealthCheck, error) {
+	var checks []HealthCheck
+	query := url.Values{"dc": {datacenter}}
+	if err := getJSON(client, consulAddr, "/v1/health/node/"+url.PathEscape(node), query, &checks); err != nil {
+		return nil, fmt.Errorf("failed to query health of %s: %w", node, err)
+	}
+	return checks, nil
+}
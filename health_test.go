@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Services and checks touched by a run
+func TestCollectHealthTargets(t *testing.T) {
+	operations := []map[string]interface{}{
+		{
+			"Node": map[string]interface{}{
+				"Verb": "set",
+				"Node": map[string]interface{}{"Node": "web-001"},
+			},
+		},
+		{
+			"Service": map[string]interface{}{
+				"Verb":    "set",
+				"Node":    "web-001",
+				"Service": map[string]interface{}{"ID": "nginx-80", "Service": "nginx"},
+			},
+		},
+		{
+			"Service": map[string]interface{}{
+				"Verb":    "set",
+				"Node":    "web-001",
+				"Service": map[string]interface{}{"Service": "ssh"},
+			},
+		},
+		{
+			"Service": map[string]interface{}{
+				"Verb":    "delete",
+				"Node":    "web-002",
+				"Service": map[string]interface{}{"ID": "old"},
+			},
+		},
+		{
+			"Check": map[string]interface{}{
+				"Verb":  "set",
+				"Node":  "web-002",
+				"Check": map[string]interface{}{"Name": "disk"},
+			},
+		},
+	}
+
+	got := collectHealthTargets(operations)
+
+	want := healthTargets{
+		"web-001": {
+			Services: map[string]bool{"nginx-80": true, "ssh": true},
+			Checks:   map[string]bool{},
+		},
+		"web-002": {
+			Services: map[string]bool{},
+			Checks:   map[string]bool{"disk": true},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectHealthTargets() = %+v, want %+v", got, want)
+	}
+}
+
+// Matching node health against the wanted status
+func TestEvaluateNodeHealth(t *testing.T) {
+	target := &nodeTargets{
+		Services: map[string]bool{"nginx": true},
+		Checks:   map[string]bool{"disk": true, "mem": true},
+	}
+
+	checks := []HealthCheck{
+		{Node: "web-001", CheckID: "serfHealth", Status: "critical"},
+		{Node: "web-001", CheckID: "service:nginx", ServiceID: "nginx", Status: "warning", Output: "slow"},
+		{Node: "web-001", CheckID: "disk", Status: "passing"},
+	}
+
+	tests := []struct {
+		name        string
+		wanted      int
+		wantPending []string
+	}{
+		{
+			name:   "passing required",
+			wanted: checkSeverity["passing"],
+			wantPending: []string{
+				"web-001/mem: missing",
+				"web-001/service:nginx: warning (slow)",
+			},
+		},
+		{
+			name:   "warning accepted",
+			wanted: checkSeverity["warning"],
+			wantPending: []string{
+				"web-001/mem: missing",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, total := evaluateNodeHealth("web-001", target, checks, tt.wanted)
+			if total != 3 {
+				t.Errorf("evaluateNodeHealth() total = %d, want 3", total)
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("evaluateNodeHealth() pending = %v, want %v", pending, tt.wantPending)
+			}
+		})
+	}
+}
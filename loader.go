@@ -2,145 +2,760 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
 )
 
-// loadVars loads vars from a file or directory
-func loadVars(path string, verbose bool) (map[string]interface{}, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("cannot access vars path: %w", err)
+// NodeSource records the vars file a node was loaded from
+type NodeSource struct {
+	Root string // The -vars argument the node was loaded through
+	Path string // File path as found on disk
+	Rel  string // Path relative to the vars directory (base name for a single file)
+}
+
+// Dir returns the directory of the file relative to the vars directory, using
+// forward slashes; "" for files at the top level.
+func (s NodeSource) Dir() string {
+	dir := filepath.ToSlash(filepath.Dir(s.Rel))
+	if dir == "." {
+		return ""
 	}
+	return dir
+}
+
+// Dirs returns the components of Dir, e.g. ["prod", "web"] for prod/web.
+func (s NodeSource) Dirs() []string {
+	if dir := s.Dir(); dir != "" {
+		return strings.Split(dir, "/")
+	}
+	return []string{}
+}
+
+// File returns the base name of the file, e.g. "items.yaml".
+func (s NodeSource) File() string {
+	return filepath.Base(s.Rel)
+}
+
+// Name returns the base name of the file without its extension.
+func (s NodeSource) Name() string {
+	file := s.File()
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// stdinPath is the -vars / -mapping value that reads from standard input
+const stdinPath = "-"
+
+// LoadOptions controls how vars files are parsed and combined
+type LoadOptions struct {
+	Format     string // Forced vars format, "" to detect per file
+	Duplicates string // Duplicate node policy: error, first, last or deep-merge
+	ListMerge  string // How deep-merge combines lists: replace or append
+
+	TFResources []string // Terraform resource type/address or output name globs
+	TFKey       string   // Terraform attribute used as the node key
+
+	CSVKey     string // CSV column holding the node name, "" for the first
+	CSVListSep string // Separator for CSV columns hinted as list
+
+	Root    string // Dotted path to the nodes inside each vars file, "" for the top level
+	ListKey string // Field naming each node when the nodes are a list of objects
+
+	Overlays []string // Vars paths deep-merged onto the loaded nodes, in order
+
+	Include []string // Globs a vars directory file must match, empty for all
+	Exclude []string // Globs of vars directory files and directories to skip
+
+	Workers int  // Vars files parsed concurrently when loading a directory
+	Strict  bool // Fail on any skipped file or node instead of warning
+	Verbose bool
+
+	problems *[]string         // Problems collected in strict mode, set by loadVars
+	layers   defaultLayers     // Directory defaults per node, set by loadVars; nil to apply them at once
+	removals fieldRemovals     // Fields removed by overlays per node, set by loadVars
+	rename   *strings.Replacer // Maps temporary copies back to their source in warnings, e.g. for git:
+	deferred *[]string         // Warnings held back while a file is parsed concurrently
+}
+
+// plain returns the options for files that hold node data rather than
+// nodes, such as directory defaults and Ansible group_vars.
+func (o LoadOptions) plain() LoadOptions {
+	o.Root, o.ListKey = "", ""
+	return o
+}
+
+// displayPath returns path as logged, naming the source of a temporary
+// copy instead of the copy itself.
+func (o LoadOptions) displayPath(path string) string {
+	if o.rename == nil {
+		return path
+	}
+	return o.rename.Replace(path)
+}
+
+// warn reports a problem that drops vars from the run. It is logged and
+// skipped normally, and collected in strict mode so loadVars can fail with
+// every problem at once.
+func (o LoadOptions) warn(format string, args ...interface{}) {
+	message := o.displayPath(fmt.Sprintf(format, args...))
+	if o.deferred != nil {
+		*o.deferred = append(*o.deferred, message)
+		return
+	}
+	if o.Strict && o.problems != nil {
+		*o.problems = append(*o.problems, message)
+		return
+	}
+	log.Printf("[WARN] %s", message)
+}
 
+// loadVars loads vars from each path in order. A path may be a file, a
+// directory, a glob, stdin or a scheme-prefixed source such as
+// ansible:<inventory>, terraform:<state> or git:<rev>:<path>; nodes found in more than one place are
+// resolved by the duplicate policy. The vars format is forced by
+// opts.Format, or detected from each file's extension (from the content
+// for stdin). Overlays are then applied in order, node inheritance is
+// resolved, directory defaults are merged beneath the result and fields
+// removed by overlays are dropped from it. In strict mode skipped files,
+// non-map nodes and duplicates fail the load, with every problem reported
+// in the error.
+func loadVars(paths []string, opts LoadOptions) (map[string]interface{}, map[string]NodeSource, error) {
 	allVars := make(map[string]interface{})
+	sources := make(map[string]NodeSource)
 
-	if !info.IsDir() {
-		// Single file mode
-		log.Printf("[INFO] Loading vars from file: %s", path)
-		vars, err := loadYAMLFile(path)
+	var problems []string
+	opts.problems = &problems
+	opts.layers = make(defaultLayers)
+	opts.removals = make(fieldRemovals)
+
+	for _, path := range paths {
+		if err := loadVarsPath(path, opts, allVars, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, path := range opts.Overlays {
+		if err := applyOverlay(path, opts, allVars, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := resolveInheritance(allVars, sources, opts); err != nil {
+		return nil, nil, err
+	}
+
+	// Defaults go beneath the final nodes, so no field set on a node in
+	// any source, or inherited by it, is overridden by them. Fields removed
+	// by overlays are then removed again, wherever they came from.
+	opts.layers.apply(allVars, opts.ListMerge)
+	opts.removals.apply(allVars)
+
+	if opts.Strict {
+		checkNodeShapes(allVars, sources, opts)
+		if len(problems) > 0 {
+			return nil, nil, fmt.Errorf("strict mode: %d problems found:\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+		}
+	}
+
+	if len(allVars) == 0 {
+		return nil, nil, fmt.Errorf("no nodes found in %s", strings.Join(paths, ", "))
+	}
+
+	if len(paths) > 1 || opts.Verbose {
+		reportNodeSources(paths, sources, opts.Verbose)
+	}
+
+	return allVars, sources, nil
+}
+
+// loadVarsPath loads a single -vars argument into allVars
+func loadVarsPath(path string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	if path == stdinPath {
+		return loadVarsFromStdin(opts, allVars, sources)
+	}
+
+	if scheme, target, ok := strings.Cut(path, ":"); ok {
+		switch scheme {
+		case "ansible":
+			return loadAnsibleInventory(target, path, opts, allVars, sources)
+		case "terraform":
+			return loadTerraform(target, path, opts, allVars, sources)
+		case "git":
+			return loadGit(target, path, opts, allVars, sources)
+		}
+	}
+
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("invalid vars glob %s: %w", path, err)
 		}
-		allVars = vars
-		log.Printf("[INFO] Loaded %d nodes", len(allVars))
-	} else {
-		// Directory mode
-		vars, err := loadVarsFromDirectory(path, verbose)
+		if len(matches) == 0 {
+			return fmt.Errorf("no vars paths match %s", path)
+		}
+		for _, match := range matches {
+			if err := loadVarsEntry(match, path, opts, allVars, sources); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return loadVarsEntry(path, path, opts, allVars, sources)
+}
+
+// loadVarsEntry loads a file or directory found through the root argument
+func loadVarsEntry(path, root string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot access vars path: %w", err)
+	}
+
+	if info.IsDir() {
+		return loadVarsFromDirectory(path, root, opts, allVars, sources)
+	}
+
+	log.Printf("[INFO] Loading vars from file: %s", opts.displayPath(path))
+	vars, err := loadVarsFile(path, detectVarsFormat(path, opts.Format), opts)
+	if err != nil {
+		return err
+	}
+	nodeCount, err := mergeVars(allVars, sources, vars, nil, NodeSource{Root: root, Path: path, Rel: filepath.Base(path)}, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Loaded %d nodes", nodeCount)
+
+	return nil
+}
+
+// loadVarsFromStdin loads a single vars document piped to stdin
+func loadVarsFromStdin(opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	log.Printf("[INFO] Loading vars from stdin")
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format, err = sniffVarsFormat(data)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		allVars = vars
+		log.Printf("[INFO] Detected %s vars on stdin", format)
 	}
 
-	if len(allVars) == 0 {
-		return nil, fmt.Errorf("no nodes found in %s", path)
+	vars, err := parseVars(data, format, opts)
+	if err != nil {
+		return withSource("stdin", data, err)
 	}
 
-	return allVars, nil
+	nodeCount, err := mergeVars(allVars, sources, vars, nil, NodeSource{Root: stdinPath, Path: stdinPath, Rel: "stdin"}, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Loaded %d nodes", nodeCount)
+
+	return nil
 }
 
-// loadVarsFromDirectory loads all YAML files from a directory recursively
-func loadVarsFromDirectory(path string, verbose bool) (map[string]interface{}, error) {
-	log.Printf("[INFO] Loading vars from directory: %s", path)
+// checkNodeShapes reports nodes whose data is not a map; they would be
+// skipped when generating operations.
+func checkNodeShapes(allVars map[string]interface{}, sources map[string]NodeSource, opts LoadOptions) {
+	keys := make([]string, 0, len(allVars))
+	for key := range allVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := allVars[key].(map[string]interface{}); !ok {
+			opts.warn("Node '%s' in %s is not a map", key, sources[key].Path)
+		}
+	}
+}
+
+// reportNodeSources summarizes how many nodes each -vars argument
+// contributed and, in verbose mode, which file every node came from.
+func reportNodeSources(paths []string, sources map[string]NodeSource, verbose bool) {
+	counts := make(map[string]int)
+	for _, source := range sources {
+		counts[source.Root]++
+	}
+	for _, path := range paths {
+		log.Printf("[INFO] Source %s: %d nodes", path, counts[path])
+	}
+
+	if !verbose {
+		return
+	}
+
+	nodes := make([]string, 0, len(sources))
+	for node := range sources {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	for _, node := range nodes {
+		log.Printf("[DEBUG] Node %s loaded from %s", node, sources[node].Path)
+	}
+}
+
+// defaultLoadWorkers is the default number of vars files parsed at once
+const defaultLoadWorkers = 8
+
+// loadVarsFromDirectory loads all vars files from a directory recursively.
+// Files are parsed concurrently but merged in walk order, so duplicates
+// resolve exactly as if they were loaded one by one.
+func loadVarsFromDirectory(path, root string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	log.Printf("[INFO] Loading vars from directory: %s", opts.displayPath(path))
+
+	filter, err := newVarsFilter(path, opts)
+	if err != nil {
+		return err
+	}
+
+	files, err := findVarsFiles(path, filter, opts)
+	if err != nil {
+		return fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	results := parseVarsFiles(files, opts)
 
-	allVars := make(map[string]interface{})
 	fileCount := 0
+	nodeTotal := 0
+	defaults := make(map[string]map[string]interface{})
+
+	for i, p := range files {
+		result := results[i]
+		relPath, _ := filepath.Rel(path, p)
+		if opts.Verbose {
+			log.Printf("[DEBUG] Loading: %s", relPath)
+		}
+
+		// Replay warnings raised while parsing, in file order
+		for _, warning := range result.warnings {
+			opts.warn("%s", warning)
+		}
+
+		if result.err != nil {
+			opts.warn("Skipping vars file: %v", result.err)
+			continue // Skip this file but continue
+		}
+
+		dirDefaults, err := loadDirectoryDefaults(filepath.Clean(path), filepath.Dir(p), opts, defaults)
+		if err != nil {
+			return fmt.Errorf("failed to walk directory: %w", err)
+		}
+		fileCount++
+		nodeCount, err := mergeVars(allVars, sources, result.vars, dirDefaults, NodeSource{Root: root, Path: p, Rel: relPath}, opts)
+		if err != nil {
+			return fmt.Errorf("failed to walk directory: %w", err)
+		}
+		nodeTotal += nodeCount
+		log.Printf("[INFO] Loaded %d nodes from %s", nodeCount, relPath)
+	}
+
+	log.Printf("[INFO] Total: %d files, %d nodes loaded", fileCount, nodeTotal)
+	return nil
+}
+
+// findVarsFiles returns the vars files below path in walk (lexical) order,
+// leaving out directory defaults and files rejected by filter.
+func findVarsFiles(path string, filter *varsFilter, opts LoadOptions) ([]string, error) {
+	var files []string
 
 	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
-			return err
+			if !opts.Strict || p == path {
+				return err
+			}
+			opts.warn("Cannot read %s: %v", p, err)
+			return nil
 		}
 
-		// Skip directories
+		rel, _ := filepath.Rel(path, p)
+		rel = filepath.ToSlash(rel)
+
+		// Skip directories, and everything below excluded ones
 		if info.IsDir() {
+			if p == path {
+				return nil
+			}
+			if pattern, ok := filter.excluded(rel, true); ok {
+				if opts.Verbose {
+					log.Printf("[DEBUG] Skipping directory %s (excluded by %s)", rel, pattern)
+				}
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Skip non-YAML files
-		ext := filepath.Ext(p)
-		if ext != ".yaml" && ext != ".yml" {
+		// Skip files that are not in a supported vars format
+		if _, ok := varsExtensions[strings.ToLower(filepath.Ext(p))]; !ok {
 			return nil
 		}
 
-		// Process YAML file
-		relPath, _ := filepath.Rel(path, p)
-		if verbose {
-			log.Printf("[DEBUG] Loading: %s", relPath)
+		// Directory defaults are applied to nodes, not loaded as nodes
+		if isDefaultsFile(p) {
+			return nil
 		}
 
-		vars, err := loadYAMLFile(p)
-		if err != nil {
-			log.Printf("[WARN] Failed to parse %s: %v", relPath, err)
-			return nil // Skip this file but continue
+		if pattern, ok := filter.excluded(rel, false); ok {
+			if opts.Verbose {
+				log.Printf("[DEBUG] Skipping %s (excluded by %s)", rel, pattern)
+			}
+			return nil
+		}
+		if !filter.included(rel) {
+			if opts.Verbose {
+				log.Printf("[DEBUG] Skipping %s (not included)", rel)
+			}
+			return nil
 		}
 
-		fileCount++
-		nodeCount := mergeVars(allVars, vars, relPath)
-		log.Printf("[INFO] Loaded %d nodes from %s", nodeCount, relPath)
-
+		files = append(files, p)
 		return nil
 	})
 
+	return files, err
+}
+
+// varsFileResult is the outcome of parsing one file of a directory
+type varsFileResult struct {
+	vars     map[string]interface{}
+	warnings []string
+	err      error
+}
+
+// parseVarsFiles parses files with up to opts.Workers goroutines. Results
+// are returned in the order of files; warnings are held back in each result
+// so the caller can report them in that order too.
+func parseVarsFiles(files []string, opts LoadOptions) []varsFileResult {
+	results := make([]varsFileResult, len(files))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(opts.Workers, 1), len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fileOpts := opts
+				fileOpts.deferred = &results[i].warnings
+				results[i].vars, results[i].err = loadVarsFile(files[i], detectVarsFormat(files[i], opts.Format), fileOpts)
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// defaultsName is the base name of the reserved per-directory defaults file
+const defaultsName = "_defaults"
+
+func isDefaultsFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)) == defaultsName
+}
+
+// loadDirectoryDefaults returns the defaults for nodes in dir: the defaults
+// files of every directory from root down to dir, deep-merged so nearer
+// directories override farther ones. Results are cached per directory.
+func loadDirectoryDefaults(root, dir string, opts LoadOptions, cache map[string]map[string]interface{}) (map[string]interface{}, error) {
+	if cached, ok := cache[dir]; ok {
+		return cached, nil
+	}
+
+	var inherited map[string]interface{}
+	if dir != root && filepath.Dir(dir) != dir {
+		parent, err := loadDirectoryDefaults(root, filepath.Dir(dir), opts, cache)
+		if err != nil {
+			return nil, err
+		}
+		inherited = parent
+	}
+
+	own, err := loadDefaultsFile(dir, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
+		return nil, err
+	}
+
+	result := inherited
+	if own != nil {
+		if inherited == nil {
+			result = own
+		} else {
+			result = deepMerge(inherited, own, opts.ListMerge).(map[string]interface{})
+		}
+	}
+
+	cache[dir] = result
+	return result, nil
+}
+
+// loadDefaultsFile loads the defaults file of a single directory, if any
+func loadDefaultsFile(dir string, opts LoadOptions) (map[string]interface{}, error) {
+	for _, ext := range []string{".yaml", ".yml", ".json", ".toml", ".hcl"} {
+		path := filepath.Join(dir, defaultsName+ext)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		defaults, err := loadVarsFile(path, detectVarsFormat(path, opts.Format), opts.plain())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load defaults: %w", err)
+		}
+		if opts.Verbose {
+			log.Printf("[DEBUG] Loaded %d default fields from %s", len(defaults), opts.displayPath(path))
+		}
+		return defaults, nil
+	}
+
+	return nil, nil
+}
+
+// defaultLayers holds the directory defaults of each node, kept apart from
+// the node data until loading is done.
+type defaultLayers map[string]map[string]interface{}
+
+// set records the defaults of a node taken from a file. With merge, they
+// are merged onto the defaults from the node's earlier sources, as the
+// node data is for deep-merged duplicates.
+func (l defaultLayers) set(key string, defaults map[string]interface{}, merge bool, listMode string) {
+	if l == nil {
+		return // Already applied to the node data
 	}
 
-	log.Printf("[INFO] Total: %d files, %d nodes loaded", fileCount, len(allVars))
-	return allVars, nil
+	if merge {
+		if len(defaults) == 0 {
+			return
+		}
+		if l[key] != nil {
+			defaults = deepMerge(l[key], defaults, listMode).(map[string]interface{})
+		}
+	}
+
+	if len(defaults) == 0 {
+		delete(l, key)
+		return
+	}
+	l[key] = defaults
+}
+
+// apply deep-merges each map node onto its defaults, so values set on the
+// node win.
+func (l defaultLayers) apply(vars map[string]interface{}, listMode string) {
+	for key, defaults := range l {
+		if node, ok := vars[key].(map[string]interface{}); ok {
+			vars[key] = withDefaults(node, defaults, listMode)
+		}
+	}
+}
+
+// withDefaults returns a map node merged onto defaults; other values are
+// returned as they are.
+func withDefaults(value interface{}, defaults map[string]interface{}, listMode string) interface{} {
+	if _, ok := value.(map[string]interface{}); !ok || len(defaults) == 0 {
+		return value
+	}
+	return deepMerge(defaults, value, listMode)
 }
 
-// loadYAMLFile loads a single YAML file
-func loadYAMLFile(path string) (map[string]interface{}, error) {
+// loadYAMLFile loads a single YAML file; every document in it is loaded
+func loadYAMLFile(path string, opts LoadOptions) (map[string]interface{}, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	var result map[string]interface{}
-	err = yaml.Unmarshal(data, &result)
+	docs, err := parseYAMLDocuments(data, newYAMLTags(path))
+	if err != nil {
+		return nil, withSource(path, data, err)
+	}
+	return mergeYAMLDocuments(docs, path, opts)
+}
+
+func parseYAML(data []byte, opts LoadOptions) (map[string]interface{}, error) {
+	docs, err := parseYAMLDocuments(data, newYAMLTags(""))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, err
+	}
+	return mergeYAMLDocuments(docs, "", opts)
+}
+
+// parseYAMLDocuments decodes each "---" separated document, expanding
+// custom tags unless tags is nil; empty documents are dropped.
+func parseYAMLDocuments(data []byte, tags *yamlTags) ([]interface{}, error) {
+	nodes, err := parseYAMLNodes(data, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []interface{}
+	for _, node := range nodes {
+		doc, err := decodeYAMLNode(node)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// mergeYAMLDocuments selects the nodes of each document of one file and
+// combines them, resolving nodes defined in several documents by the
+// duplicate policy.
+func mergeYAMLDocuments(docs []interface{}, path string, opts LoadOptions) (map[string]interface{}, error) {
+	switch len(docs) {
+	case 0:
+		return map[string]interface{}{}, nil
+	case 1:
+		return selectNodes(docs[0], opts)
+	}
+
+	result := make(map[string]interface{})
+	sources := make(map[string]NodeSource)
+	opts.layers = nil // Documents are merged into this file's nodes only
+	for i, doc := range docs {
+		name := fmt.Sprintf("document %d", i+1)
+		if path != "" {
+			name = fmt.Sprintf("%s document %d", path, i+1)
+		}
+
+		nodes, err := selectNodes(doc, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		nodeCount, err := mergeVars(result, sources, nodes, nil, NodeSource{Path: name, Rel: name}, opts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Verbose {
+			log.Printf("[DEBUG] Loaded %d nodes from %s", nodeCount, name)
+		}
 	}
 
 	return result, nil
 }
 
-// loadMapping loads the mapping configuration file
+// loadMapping loads the mapping configuration file, or stdin for "-"
 func loadMapping(path string) (*MappingConfig, error) {
-	data, err := os.ReadFile(path)
+	var data []byte
+	var err error
+	if path == stdinPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read mapping file: %w", err)
 	}
 
+	name := path
+	if path == stdinPath {
+		name = "stdin"
+	}
+
 	var config MappingConfig
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse mapping YAML: %w", err)
+		return nil, withSource(name, data, yamlError("failed to parse mapping YAML", err))
+	}
+
+	// Keep the syntax tree to report template errors at their position
+	config.path, config.data = name, data
+	if config.file, err = parser.ParseBytes(data, 0); err != nil {
+		return nil, withSource(name, data, yamlError("failed to parse mapping YAML", err))
 	}
 
 	if len(config.Operations) == 0 {
 		return nil, fmt.Errorf("no operations defined in mapping")
 	}
 
+	if err := config.Protect.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Schema.validate(); err != nil {
+		return nil, err
+	}
+
 	log.Printf("[INFO] Loaded mapping with %d operation rules", len(config.Operations))
 
 	return &config, nil
 }
 
-// mergeVars merges source vars into target, checking for duplicates
-func mergeVars(target, source map[string]interface{}, sourcePath string) int {
-	added := 0
-	for k, v := range source {
-		if _, exists := target[k]; exists {
-			log.Printf("[WARN] Duplicate node '%s' found in %s (keeping first occurrence)", k, sourcePath)
+// mergeVars merges vars into target, resolving duplicates by the configured
+// policy, and records where each node came from and the directory defaults
+// that apply to it. It returns the number of nodes taken from vars.
+func mergeVars(target map[string]interface{}, sources map[string]NodeSource, vars map[string]interface{}, defaults map[string]interface{}, source NodeSource, opts LoadOptions) (int, error) {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	taken := 0
+	for _, k := range keys {
+		v := vars[k]
+		if opts.layers == nil {
+			v = withDefaults(v, defaults, opts.ListMerge)
+		}
+
+		existing, exists := target[k]
+		if !exists {
+			target[k] = v
+			sources[k] = source
+			opts.layers.set(k, defaults, false, opts.ListMerge)
+			taken++
 			continue
 		}
-		target[k] = v
-		added++
+
+		previous := sources[k].Path
+		switch opts.Duplicates {
+		case "error":
+			if opts.Strict {
+				opts.warn("Duplicate node '%s' in %s (already loaded from %s)", k, source.Path, previous)
+				continue
+			}
+			return taken, fmt.Errorf("duplicate node '%s' in %s (already loaded from %s)", k, source.Path, previous)
+
+		case "last":
+			log.Printf("[WARN] Duplicate node '%s' found in %s (replacing occurrence from %s)", k, opts.displayPath(source.Path), opts.displayPath(previous))
+			target[k] = v
+			opts.layers.set(k, defaults, false, opts.ListMerge)
+
+		case "deep-merge":
+			log.Printf("[INFO] Merging duplicate node '%s' from %s onto %s", k, opts.displayPath(source.Path), opts.displayPath(previous))
+			target[k] = deepMerge(existing, v, opts.ListMerge)
+			opts.layers.set(k, defaults, true, opts.ListMerge)
+
+		default:
+			opts.warn("Duplicate node '%s' found in %s (keeping first occurrence from %s)", k, source.Path, previous)
+			continue
+		}
+
+		sources[k] = source
+		taken++
 	}
-	return added
+	return taken, nil
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeVarsFiles creates files (relative path -> content) below dir
+func writeVarsFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Multiple vars sources are merged in order, first occurrence wins
+func TestLoadVarsMultipleSources(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"shared/a.yaml": "web-001:\n  owner: shared\nweb-002:\n  owner: shared\n",
+		"team/b.yaml":   "web-002:\n  owner: team\n",
+		"team/c.json":   `{"web-003": {"owner": "team"}}`,
+	})
+
+	shared := filepath.Join(dir, "shared")
+	teamGlob := filepath.Join(dir, "team", "*")
+
+	vars, sources, err := loadVars([]string{shared, teamGlob}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	if len(vars) != 3 {
+		t.Fatalf("loadVars() returned %d nodes, want 3", len(vars))
+	}
+
+	if owner := vars["web-002"].(map[string]interface{})["owner"]; owner != "shared" {
+		t.Errorf("web-002 owner = %v, want shared (first occurrence)", owner)
+	}
+
+	wantRoots := map[string]string{"web-001": shared, "web-002": shared, "web-003": teamGlob}
+	for node, root := range wantRoots {
+		if sources[node].Root != root {
+			t.Errorf("%s root = %q, want %q", node, sources[node].Root, root)
+		}
+	}
+
+	if _, _, err := loadVars([]string{filepath.Join(dir, "missing-*")}, LoadOptions{}); err == nil {
+		t.Error("loadVars() expected error for glob without matches")
+	}
+}
+
+// Duplicate node policies
+func TestLoadVarsDuplicatePolicy(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"1-base.yaml": "web-001:\n  ip: 10.0.0.1\n  tags: [base]\n  meta:\n    owner: web\n",
+		"2-prod.yaml": "web-001:\n  tags: [prod]\n  meta:\n    env: prod\n",
+	})
+
+	tests := []struct {
+		name     string
+		opts     LoadOptions
+		wantErr  bool
+		wantNode map[string]interface{}
+	}{
+		{
+			name:    "error",
+			opts:    LoadOptions{Duplicates: "error"},
+			wantErr: true,
+		},
+		{
+			name: "first",
+			opts: LoadOptions{Duplicates: "first"},
+			wantNode: map[string]interface{}{
+				"ip": "10.0.0.1", "tags": []interface{}{"base"},
+				"meta": map[string]interface{}{"owner": "web"},
+			},
+		},
+		{
+			name: "last",
+			opts: LoadOptions{Duplicates: "last"},
+			wantNode: map[string]interface{}{
+				"tags": []interface{}{"prod"},
+				"meta": map[string]interface{}{"env": "prod"},
+			},
+		},
+		{
+			name: "deep-merge appending lists",
+			opts: LoadOptions{Duplicates: "deep-merge", ListMerge: "append"},
+			wantNode: map[string]interface{}{
+				"ip": "10.0.0.1", "tags": []interface{}{"base", "prod"},
+				"meta": map[string]interface{}{"owner": "web", "env": "prod"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, _, err := loadVars([]string{dir}, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(vars["web-001"], tt.wantNode) {
+				t.Errorf("web-001 = %v, want %v", vars["web-001"], tt.wantNode)
+			}
+		})
+	}
+}
+
+// Directory defaults are inherited, nearer directories win
+func TestLoadVarsDirectoryDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"_defaults.yaml":         "owner: platform\ndatacenter: dc1\nmeta:\n  tier: base\n",
+		"prod/_defaults.json":    `{"datacenter": "prod", "meta": {"env": "prod"}}`,
+		"prod/web/nodes.yaml":    "web-001:\n  ip: 10.0.0.1\n  owner: web\n",
+		"staging/nodes.yaml":     "web-101:\n  ip: 10.1.0.1\n",
+		"staging/_defaults.toml": "[meta]\ntier = \"staging\"\n",
+	})
+
+	vars, _, err := loadVars([]string{dir + "/"}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	if len(vars) != 2 {
+		t.Fatalf("loadVars() returned %d nodes, want 2 (defaults must not become nodes)", len(vars))
+	}
+
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{
+			"ip": "10.0.0.1", "owner": "web", "datacenter": "prod",
+			"meta": map[string]interface{}{"tier": "base", "env": "prod"},
+		},
+		"web-101": map[string]interface{}{
+			"ip": "10.1.0.1", "owner": "platform", "datacenter": "dc1",
+			"meta": map[string]interface{}{"tier": "staging"},
+		},
+	}
+
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("loadVars() = %v, want %v", vars, want)
+	}
+}
+
+// Directory defaults never override a field set on the node in any source
+func TestLoadVarsDefaultsAcrossSources(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"base/web.yaml":       "web-001: {role: custom}\nweb-002: {role: custom}\n",
+		"prod/_defaults.yaml": "role: generic\nenv: prod\n",
+		"prod/web.yaml":       "web-001: {env: staging}\nweb-002: {port: 80}\n",
+		"plain/web.yaml":      "web-002: {port: 8080}\n",
+	})
+	base, prod, plain := filepath.Join(dir, "base"), filepath.Join(dir, "prod"), filepath.Join(dir, "plain")
+
+	tests := []struct {
+		name       string
+		paths      []string
+		duplicates string
+		want       map[string]interface{}
+	}{
+		{
+			name:       "deep-merge",
+			paths:      []string{base, prod},
+			duplicates: "deep-merge",
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"role": "custom", "env": "staging"},
+				"web-002": map[string]interface{}{"role": "custom", "env": "prod", "port": uint64(80)},
+			},
+		},
+		{
+			name:       "first",
+			paths:      []string{base, prod},
+			duplicates: "first",
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"role": "custom"},
+				"web-002": map[string]interface{}{"role": "custom"},
+			},
+		},
+		{
+			name:       "last replaces the defaults too",
+			paths:      []string{prod, plain},
+			duplicates: "last",
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"role": "generic", "env": "staging"},
+				"web-002": map[string]interface{}{"port": uint64(8080)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, _, err := loadVars(tt.paths, LoadOptions{Duplicates: tt.duplicates, ListMerge: "replace"})
+			if err != nil {
+				t.Fatalf("loadVars() error = %v", err)
+			}
+			if !reflect.DeepEqual(vars, tt.want) {
+				t.Errorf("vars = %v, want %v", vars, tt.want)
+			}
+		})
+	}
+}
+
+// Strict mode fails on every problem that would otherwise be skipped
+func TestLoadVarsStrict(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"1-good.yaml":   "web-001:\n  ip: 10.0.0.1\n",
+		"2-broken.yaml": "web-002:\n  ip: [10.0.0.2\n",
+		"3-scalar.yaml": "web-003: 10.0.0.3\n",
+		"4-dup.yaml":    "web-001:\n  ip: 10.0.0.9\n",
+	})
+
+	vars, _, err := loadVars([]string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("non-strict loadVars() error = %v", err)
+	}
+	if len(vars) != 2 {
+		t.Errorf("non-strict loaded %d nodes, want 2", len(vars))
+	}
+
+	_, _, err = loadVars([]string{dir}, LoadOptions{Strict: true})
+	if err == nil {
+		t.Fatal("strict loadVars() succeeded, want error")
+	}
+	dup := fmt.Sprintf("Duplicate node 'web-001' found in %s (keeping first occurrence from %s)", filepath.Join(dir, "4-dup.yaml"), filepath.Join(dir, "1-good.yaml"))
+	for _, want := range []string{"3 problems", "2-broken.yaml", "'web-003'", dup} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+// Every document of a multi-document YAML file is loaded
+func TestLoadVarsMultiDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"nodes.yaml": `---
+web-001:
+  ip: 10.0.0.1
+  meta: {owner: web}
+---
+web-002:
+  ip: 10.0.0.2
+---
+web-001:
+  meta: {env: prod}
+---
+`,
+		"broken.yaml": "web-003:\n  ip: 10.0.0.3\n---\nweb-004:\n  ip: [10.0.0.4\n  env: prod\n",
+	})
+	path := filepath.Join(dir, "nodes.yaml")
+
+	tests := []struct {
+		name    string
+		opts    LoadOptions
+		wantErr bool
+		want001 map[string]interface{}
+	}{
+		{
+			name:    "first",
+			want001: map[string]interface{}{"ip": "10.0.0.1", "meta": map[string]interface{}{"owner": "web"}},
+		},
+		{
+			name:    "deep-merge",
+			opts:    LoadOptions{Duplicates: "deep-merge"},
+			want001: map[string]interface{}{"ip": "10.0.0.1", "meta": map[string]interface{}{"owner": "web", "env": "prod"}},
+		},
+		{
+			name:    "error",
+			opts:    LoadOptions{Duplicates: "error"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, _, err := loadVars([]string{path}, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(vars) != 2 {
+				t.Errorf("loaded %d nodes, want 2", len(vars))
+			}
+			if !reflect.DeepEqual(vars["web-001"], tt.want001) {
+				t.Errorf("web-001 = %v, want %v", vars["web-001"], tt.want001)
+			}
+		})
+	}
+
+	_, err := loadVarsFile(filepath.Join(dir, "broken.yaml"), "yaml", LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "broken.yaml:6:3:") {
+		t.Errorf("error in second document = %v, want position broken.yaml:6:3", err)
+	}
+}
+
+// Concurrent parsing merges files in walk order, like sequential loading
+func TestLoadVarsParallel(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 120; i++ {
+		files[fmt.Sprintf("group%d/%03d.yaml", i%4, i)] = fmt.Sprintf("node-%02d:\n  file: %d\n", i%30, i)
+	}
+	files["group0/list.yaml"] = "- {name: node-99}\n- {name: node-99}\n"
+	writeVarsFiles(t, dir, files)
+
+	load := func(workers int, strict bool) (map[string]interface{}, map[string]NodeSource, error) {
+		return loadVars([]string{dir}, LoadOptions{Workers: workers, ListKey: "name", Strict: strict})
+	}
+
+	wantVars, wantSources, err := load(1, false)
+	if err != nil {
+		t.Fatalf("sequential loadVars() error = %v", err)
+	}
+	_, _, wantErr := load(1, true)
+	if wantErr == nil {
+		t.Fatal("sequential strict loadVars() succeeded, want duplicate errors")
+	}
+
+	for run := 0; run < 5; run++ {
+		vars, sources, err := load(16, false)
+		if err != nil {
+			t.Fatalf("parallel loadVars() error = %v", err)
+		}
+		if !reflect.DeepEqual(vars, wantVars) || !reflect.DeepEqual(sources, wantSources) {
+			t.Fatal("parallel loadVars() differs from sequential loading")
+		}
+
+		if _, _, err := load(16, true); err == nil || err.Error() != wantErr.Error() {
+			t.Fatalf("parallel strict error = %v, want %v", err, wantErr)
+		}
+	}
+}
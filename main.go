@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"sort"
 )
 
 // version, commit and date are injected at release time by goreleaser
@@ -18,40 +20,77 @@ func main() {
 	config := parseConfig()
 	setupLogging(config)
 
-	// Load vars (file or directory)
-	varsData, err := loadVars(config.VarsPath, config.Verbose)
+	selector, err := parseNodeSelector(config.Limit, config.Select, config.LimitSource)
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid node selection: %v", err)
+	}
+
+	// Load vars (files, directories or globs, in order)
+	varsData, sources, err := loadVars(config.VarsPaths, config.loadOptions())
 	if err != nil {
 		log.Fatalf("[ERROR] Failed to load vars: %v", err)
 	}
 
+	if !selector.Empty() && selector.Count(varsData, sources) == 0 {
+		log.Fatalf("[ERROR] Node selection matches none of the %d loaded nodes", len(varsData))
+	}
+
 	// Load mapping
 	mappingConfig, err := loadMapping(config.MappingFile)
 	if err != nil {
 		log.Fatalf("[ERROR] Failed to load mapping: %v", err)
 	}
 
+	// Check every node before generating anything
+	if err := validateVars(varsData, sources, &mappingConfig.Schema); err != nil {
+		log.Fatalf("[ERROR] Vars do not match schema: %v", err)
+	}
+
 	// Generate operations for all nodes
-	operations := generateAllOperations(varsData, mappingConfig, config.Datacenter)
+	operations := generateAllOperations(varsData, sources, selector, mappingConfig, config.Datacenter)
+
+	// Drop or reject operations on protected entries
+	operations, err = applyProtection(config, mappingConfig.Protect, operations)
+	if err != nil {
+		log.Fatalf("[ERROR] Refusing to sync: %v", err)
+	}
 
 	// Execute based on mode
-	executeMode(config, operations)
+	executeMode(config, mappingConfig.Protect, operations)
 }
 
-func generateAllOperations(varsData map[string]interface{}, mappingConfig *MappingConfig, datacenter string) []map[string]interface{} {
+// generateAllOperations walks nodes in key order; within a node, operations
+// follow rule order and then foreach item order. Identical inputs therefore
+// always produce the same operation list, batches and payload.
+func generateAllOperations(varsData map[string]interface{}, sources map[string]NodeSource, selector *NodeSelector, mappingConfig *MappingConfig, datacenter string) []map[string]interface{} {
 	log.Printf("[INFO] Generating operations for %d nodes", len(varsData))
 	allOperations := []map[string]interface{}{}
+	selected := 0
+
+	keys := make([]string, 0, len(varsData))
+	for key := range varsData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	for key, value := range varsData {
+	for _, key := range keys {
+		value := varsData[key]
 		nodeValue, ok := value.(map[string]interface{})
 		if !ok {
 			log.Printf("[WARN] Skipping invalid node: %s", key)
 			continue
 		}
 
+		if !selector.Match(key, nodeValue, sources[key]) {
+			continue
+		}
+		selected++
+
 		ctx := ExecutionContext{
 			Key:        key,
 			Value:      nodeValue,
 			Datacenter: datacenter,
+			Source:     sources[key],
 		}
 
 		operations, err := GenerateOperations(ctx, mappingConfig)
@@ -63,11 +102,31 @@ func generateAllOperations(varsData map[string]interface{}, mappingConfig *Mappi
 		allOperations = append(allOperations, operations...)
 	}
 
+	if !selector.Empty() {
+		log.Printf("[INFO] Selected %d of %d nodes", selected, len(varsData))
+	}
 	log.Printf("[INFO] Generated %d operations", len(allOperations))
 	return allOperations
 }
 
-func executeMode(config Config, operations []map[string]interface{}) {
+// applyProtection filters operations through the protect list. The catalog
+// is read in every mode so -dry-run and -payload show what a sync would
+// send; a preview that cannot reach Consul warns that it only checked the
+// generated operations.
+func applyProtection(config Config, protect ProtectConfig, operations []map[string]interface{}) ([]map[string]interface{}, error) {
+	catalog, err := fetchProtectCatalog(config.ConsulAddr, config.Datacenter, protect, operations)
+	if err != nil {
+		if !config.DryRun && !config.Payload {
+			return nil, fmt.Errorf("failed to read catalog for protection: %w", err)
+		}
+		log.Printf("[WARN] Cannot read the catalog for protection: %v", err)
+		log.Printf("[WARN] This preview may differ from a sync: node_meta protection only covers node meta generated by this run, and Node deletions are not checked for protected services")
+	}
+
+	return protectOperations(operations, protect, catalog)
+}
+
+func executeMode(config Config, protect ProtectConfig, operations []map[string]interface{}) {
 	// Output payload if requested
 	if config.Payload {
 		outputPayload(operations, config.Datacenter, config.Verbose)
@@ -80,10 +139,23 @@ func executeMode(config Config, operations []map[string]interface{}) {
 		return
 	}
 
+	// Check guardrails before anything is sent
+	err := EnforceSafetyThresholds(config.ConsulAddr, config.Datacenter, operations, protect, config.Safety, config.Force)
+	if err != nil {
+		log.Fatalf("[ERROR] Refusing to sync: %v", err)
+	}
+
 	// Execute operations
-	err := ExecuteOperations(config.ConsulAddr, operations, config.Verbose)
+	err = ExecuteOperations(config.ConsulAddr, operations, config.Verbose)
 	if err != nil {
 		log.Fatalf("[ERROR] Failed to execute operations: %v", err)
 	}
 	log.Printf("[INFO] Successfully synced %d operations", len(operations))
+
+	if config.WaitHealthy {
+		err := WaitForHealthy(config.ConsulAddr, config.Datacenter, operations, config.WaitStatus, config.WaitTimeout, config.Verbose)
+		if err != nil {
+			log.Fatalf("[ERROR] Health checks did not pass: %v", err)
+		}
+	}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Operations are ordered by node key, then rule order, then foreach index
+func TestGenerateAllOperationsOrder(t *testing.T) {
+	varsData := map[string]interface{}{}
+	for _, key := range []string{"node-c", "node-a", "node-d", "node-b", "node-e"} {
+		varsData[key] = map[string]interface{}{
+			"ports": []interface{}{float64(80), float64(443)},
+		}
+	}
+
+	mapping := &MappingConfig{
+		Operations: []OperationRule{
+			{
+				Type:     "Node",
+				Template: map[string]interface{}{"Node": "{{ .Key }}"},
+			},
+			{
+				Type:    "Service",
+				Foreach: "{{ .Value.ports }}",
+				Template: map[string]interface{}{
+					"Node":    "{{ .Key }}",
+					"Service": map[string]interface{}{"Service": "web", "Port": "{{ .Item }}"},
+				},
+			},
+		},
+	}
+
+	selector := &NodeSelector{}
+	first := generateAllOperations(varsData, nil, selector, mapping, "dc1")
+
+	var order []string
+	for _, op := range first {
+		opType, _, node := describeOperation(op)
+		order = append(order, node+"/"+opType)
+	}
+
+	want := []string{}
+	for _, node := range []string{"node-a", "node-b", "node-c", "node-d", "node-e"} {
+		want = append(want, node+"/Node", node+"/Service", node+"/Service")
+	}
+	if len(order) != len(want) {
+		t.Fatalf("generated %d operations, want %d", len(order), len(want))
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("operation %d = %s, want %s (order %v)", i, order[i], want[i], order)
+		}
+	}
+
+	if port := first[1]["Service"].(map[string]interface{})["Service"].(map[string]interface{})["Port"]; port != 80 {
+		t.Errorf("first foreach item Port = %v, want 80", port)
+	}
+
+	firstJSON, _ := json.Marshal(first)
+	for i := 0; i < 5; i++ {
+		again, _ := json.Marshal(generateAllOperations(varsData, nil, selector, mapping, "dc1"))
+		if string(again) != string(firstJSON) {
+			t.Fatal("generateAllOperations() output differs between runs")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+// deepMerge layers override onto base. Maps are merged key by key
+// recursively; lists are replaced, or appended to when listMode is
+// "append"; any other value in override replaces the one in base. Neither
+// input is modified.
+func deepMerge(base, override interface{}, listMode string) interface{} {
+	switch o := override.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+		merged := make(map[string]interface{}, len(b)+len(o))
+		for k, v := range b {
+			merged[k] = v
+		}
+		for k, v := range o {
+			if existing, exists := merged[k]; exists {
+				merged[k] = deepMerge(existing, v, listMode)
+			} else {
+				merged[k] = v
+			}
+		}
+		return merged
+
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || listMode != "append" {
+			return o
+		}
+		merged := make([]interface{}, 0, len(b)+len(o))
+		merged = append(merged, b...)
+		return append(merged, o...)
+
+	default:
+		return override
+	}
+}
+
+// mergeShallow returns base with override's top-level keys replacing its
+// own, matching Ansible's default hash_behaviour=replace.
+func mergeShallow(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Layering override values onto a base definition
+func TestDeepMerge(t *testing.T) {
+	base := map[string]interface{}{
+		"ip":    "10.0.0.1",
+		"meta":  map[string]interface{}{"owner": "web", "rack": "r1"},
+		"ports": []interface{}{80},
+	}
+	override := map[string]interface{}{
+		"meta":  map[string]interface{}{"rack": "r2"},
+		"ports": []interface{}{443},
+		"env":   "prod",
+	}
+
+	tests := []struct {
+		name     string
+		listMode string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "replace lists",
+			listMode: "replace",
+			want: map[string]interface{}{
+				"ip":    "10.0.0.1",
+				"env":   "prod",
+				"meta":  map[string]interface{}{"owner": "web", "rack": "r2"},
+				"ports": []interface{}{443},
+			},
+		},
+		{
+			name:     "append lists",
+			listMode: "append",
+			want: map[string]interface{}{
+				"ip":    "10.0.0.1",
+				"env":   "prod",
+				"meta":  map[string]interface{}{"owner": "web", "rack": "r2"},
+				"ports": []interface{}{80, 443},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deepMerge(base, override, tt.listMode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deepMerge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if base["meta"].(map[string]interface{})["rack"] != "r1" {
+		t.Error("deepMerge() modified its base input")
+	}
+}
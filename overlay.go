@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// removeMarker is the overlay value that deletes a node or field from the
+// base vars
+const removeMarker = "__remove__"
+
+// applyOverlay loads an -overlay path like a -vars path and deep-merges its
+// nodes onto vars. Overlay nodes missing from vars are added, and nodes or
+// fields set to removeMarker are deleted. Removed fields are also recorded
+// in opts.removals, so they stay removed once inherited fields and
+// directory defaults are merged in. Changed nodes keep their base source.
+func applyOverlay(path string, opts LoadOptions, vars map[string]interface{}, sources map[string]NodeSource) error {
+	log.Printf("[INFO] Applying overlay: %s", path)
+
+	// Overlay defaults only apply to the overlay's own entries, so they are
+	// merged into them right away
+	overlayOpts := opts
+	overlayOpts.layers = nil
+
+	overlay := make(map[string]interface{})
+	overlaySources := make(map[string]NodeSource)
+	if err := loadVarsPath(path, overlayOpts, overlay, overlaySources); err != nil {
+		return fmt.Errorf("failed to load overlay %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(overlay))
+	for key := range overlay {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changed, added, removed := 0, 0, 0
+	for _, key := range keys {
+		value := overlay[key]
+		base, exists := vars[key]
+
+		switch {
+		case value == removeMarker:
+			if !exists {
+				log.Printf("[WARN] Overlay %s removes unknown node '%s'", overlaySources[key].Path, key)
+				continue
+			}
+			delete(vars, key)
+			delete(sources, key)
+			delete(opts.layers, key)
+			delete(opts.removals, key)
+			removed++
+
+		case exists:
+			vars[key] = overlayMerge(base, value, opts.ListMerge)
+			opts.removals.record(key, value)
+			changed++
+
+		default:
+			vars[key] = overlayMerge(nil, value, opts.ListMerge)
+			sources[key] = overlaySources[key]
+			opts.removals.record(key, value)
+			added++
+		}
+
+		if opts.Verbose {
+			log.Printf("[DEBUG] Overlay node %s from %s", key, overlaySources[key].Path)
+		}
+	}
+
+	log.Printf("[INFO] Overlay %s: %d nodes changed, %d added, %d removed", path, changed, added, removed)
+	return nil
+}
+
+// overlayMerge is deepMerge with removals: a map key whose override value
+// is removeMarker is deleted from the result. Neither input is modified.
+func overlayMerge(base, override interface{}, listMode string) interface{} {
+	o, ok := override.(map[string]interface{})
+	if !ok {
+		return deepMerge(base, override, listMode)
+	}
+
+	b, _ := base.(map[string]interface{})
+	merged := make(map[string]interface{}, len(b)+len(o))
+	for k, v := range b {
+		merged[k] = v
+	}
+	for k, v := range o {
+		if v == removeMarker {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = overlayMerge(merged[k], v, listMode)
+	}
+	return merged
+}
+
+// fieldRemovals holds the fields overlays removed from each node, as a tree
+// whose leaves are removeMarker.
+type fieldRemovals map[string]map[string]interface{}
+
+// record adds the removals of an overlay node. Setting a field again in a
+// later overlay cancels its earlier removal.
+func (r fieldRemovals) record(key string, overlay interface{}) {
+	if r == nil {
+		return
+	}
+
+	fields, ok := overlay.(map[string]interface{})
+	if !ok {
+		delete(r, key)
+		return
+	}
+	if removed := mergeRemovals(r[key], fields); len(removed) > 0 {
+		r[key] = removed
+	} else {
+		delete(r, key)
+	}
+}
+
+func mergeRemovals(removed, overlay map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(removed))
+	for field, marker := range removed {
+		result[field] = marker
+	}
+
+	for field, value := range overlay {
+		if value == removeMarker {
+			result[field] = removeMarker
+			continue
+		}
+		delete(result, field)
+		if nested, ok := value.(map[string]interface{}); ok {
+			previous, _ := removed[field].(map[string]interface{})
+			if sub := mergeRemovals(previous, nested); len(sub) > 0 {
+				result[field] = sub
+			}
+		}
+	}
+	return result
+}
+
+// strip returns node without the fields removed from key. The node is not
+// modified.
+func (r fieldRemovals) strip(key string, node map[string]interface{}) map[string]interface{} {
+	if removed, ok := r[key]; ok {
+		return stripFields(node, removed)
+	}
+	return node
+}
+
+// apply strips the removed fields from every map node.
+func (r fieldRemovals) apply(vars map[string]interface{}) {
+	for key := range r {
+		if node, ok := vars[key].(map[string]interface{}); ok {
+			vars[key] = r.strip(key, node)
+		}
+	}
+}
+
+func stripFields(node, removed map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(node))
+	for field, value := range node {
+		result[field] = value
+	}
+
+	for field, marker := range removed {
+		if marker == removeMarker {
+			delete(result, field)
+			continue
+		}
+		if child, ok := result[field].(map[string]interface{}); ok {
+			result[field] = stripFields(child, marker.(map[string]interface{}))
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Overlays change, add and remove nodes and fields of the base vars
+func TestLoadVarsOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"base/web.yaml": `
+web-001:
+  ip: 10.0.0.1
+  tags: [web]
+  meta: {owner: web, rack: r1}
+web-002:
+  ip: 10.0.0.2
+db-001:
+  ip: 10.0.1.1
+`,
+		"staging/web.yaml": `
+web-001:
+  ip: 10.1.0.1
+  tags: [staging]
+  meta: {rack: __remove__, env: staging}
+web-002: __remove__
+web-009: __remove__
+cache-001:
+  ip: 10.1.2.1
+  meta: {note: __remove__}
+`,
+	})
+
+	vars, sources, err := loadVars(
+		[]string{filepath.Join(dir, "base")},
+		LoadOptions{ListMerge: "append", Overlays: []string{filepath.Join(dir, "staging")}},
+	)
+	if err != nil {
+		t.Fatalf("loadVars() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{
+			"ip":   "10.1.0.1",
+			"tags": []interface{}{"web", "staging"},
+			"meta": map[string]interface{}{"owner": "web", "env": "staging"},
+		},
+		"db-001": map[string]interface{}{"ip": "10.0.1.1"},
+		"cache-001": map[string]interface{}{
+			"ip":   "10.1.2.1",
+			"meta": map[string]interface{}{},
+		},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+
+	if _, ok := sources["web-002"]; ok {
+		t.Error("removed node web-002 still has a source")
+	}
+	if got := sources["web-001"].Root; got != filepath.Join(dir, "base") {
+		t.Errorf("web-001 source root = %q, want the base tree", got)
+	}
+	if got := sources["cache-001"].Root; got != filepath.Join(dir, "staging") {
+		t.Errorf("cache-001 source root = %q, want the overlay tree", got)
+	}
+}
+
+// __remove__ also drops fields a node gets from directory defaults or from
+// the nodes it extends
+func TestLoadVarsOverlayRemovesMergedFields(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"base/_defaults.yaml": "owner: platform\nmeta: {rack: r0, zone: z1}\n",
+		"base/web.yaml": `
+web-base:
+  _abstract: true
+  team: web
+  port: 80
+web-001:
+  _extends: web-base
+  ip: 10.0.0.1
+web-002:
+  _extends: web-base
+  ip: 10.0.0.2
+`,
+		"staging/web.yaml": `
+web-001:
+  owner: __remove__
+  team: __remove__
+  meta: {rack: __remove__}
+web-base:
+  port: __remove__
+`,
+		"restore/web.yaml": "web-001:\n  owner: ops\n",
+	})
+
+	tests := []struct {
+		name     string
+		overlays []string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "defaults and parents",
+			overlays: []string{"staging"},
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"ip": "10.0.0.1", "meta": map[string]interface{}{"zone": "z1"}},
+				"web-002": map[string]interface{}{"ip": "10.0.0.2", "team": "web", "owner": "platform", "meta": map[string]interface{}{"rack": "r0", "zone": "z1"}},
+			},
+		},
+		{
+			name:     "set again by a later overlay",
+			overlays: []string{"staging", "restore"},
+			want: map[string]interface{}{
+				"web-001": map[string]interface{}{"ip": "10.0.0.1", "owner": "ops", "meta": map[string]interface{}{"zone": "z1"}},
+				"web-002": map[string]interface{}{"ip": "10.0.0.2", "team": "web", "owner": "platform", "meta": map[string]interface{}{"rack": "r0", "zone": "z1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var overlays []string
+			for _, overlay := range tt.overlays {
+				overlays = append(overlays, filepath.Join(dir, overlay))
+			}
+			vars, _, err := loadVars([]string{filepath.Join(dir, "base")}, LoadOptions{Overlays: overlays})
+			if err != nil {
+				t.Fatalf("loadVars() error = %v", err)
+			}
+			if !reflect.DeepEqual(vars, tt.want) {
+				t.Errorf("vars = %v, want %v", vars, tt.want)
+			}
+		})
+	}
+}
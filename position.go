@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+)
+
+// sourceError is a vars or mapping error located in a source file. Parsers
+// set the line and column; withSource adds the path and an excerpt.
+type sourceError struct {
+	Path    string
+	Line    int // 1-based, 0 when only the file is known
+	Column  int // 1-based
+	Message string
+	Excerpt string
+	Err     error
+}
+
+func (e *sourceError) Error() string {
+	location := e.Path
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", e.Path, e.Line, e.Column)
+	}
+
+	message := e.Message
+	if location != "" {
+		message = location + ": " + message
+	}
+	if e.Excerpt != "" {
+		message += "\n" + e.Excerpt
+	}
+	return message
+}
+
+func (e *sourceError) Unwrap() error {
+	return e.Err
+}
+
+// positionError returns an error at a line and column of the data being
+// parsed.
+func positionError(line, column int, message string, err error) error {
+	return &sourceError{Line: line, Column: column, Message: message, Err: err}
+}
+
+// yamlError locates a go-yaml error at the token it reports.
+func yamlError(prefix string, err error) error {
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		pos := yamlErr.GetToken().Position
+		return positionError(pos.Line, pos.Column, prefix+": "+yamlErr.GetMessage(), err)
+	}
+	return fmt.Errorf("%s: %w", prefix, err)
+}
+
+// withSource attaches the file path, and for located errors a source
+// excerpt, to an error returned while parsing data. Errors already located
+// in another file are returned unchanged.
+func withSource(path string, data []byte, err error) error {
+	var located *sourceError
+	if !errors.As(err, &located) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if located.Path != "" {
+		return err // Already located, e.g. in an included file
+	}
+
+	result := *located
+	result.Path = path
+	if result.Line > 0 {
+		result.Excerpt = sourceExcerpt(data, result.Line, result.Column)
+	}
+	return &result
+}
+
+// offsetPosition converts a byte offset into a 1-based line and column.
+func offsetPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	line, column := 1, 1
+	for _, r := range string(data[:offset]) {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// excerptContext is the number of lines shown before the error line
+const excerptContext = 2
+
+// sourceExcerpt renders the lines leading up to line, marking it and
+// pointing at column with a caret:
+//
+//	   3 | web-002:
+//	>  4 |   ip: [10.0.0.2
+//	     |        ^
+func sourceExcerpt(data []byte, line, column int) string {
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	var b strings.Builder
+	for n := max(1, line-excerptContext); n <= line; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %4d | %s\n", marker, n, strings.TrimRight(lines[n-1], "\r"))
+	}
+
+	// Keep tabs so the caret lines up with the excerpt
+	var pad strings.Builder
+	text := lines[line-1]
+	for i := 1; i < column && text != ""; i++ {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		if r == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	fmt.Fprintf(&b, "       | %s^", pad.String())
+
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Parse errors name the file, line and column and show the offending line
+func TestLoadVarsFileErrorPosition(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"bad.yaml": "web-001:\n  ip: [10.0.0.1\n  type: web\n",
+		"bad.json": "{\n  \"web-001\": {\"ip\": 1,}\n}\n",
+		"bad.toml": "[web-001]\nip = \n",
+		"bad.hcl":  "web-001 {\n  ip = \"10.0.0.1\"\n  port = = 80\n}\n",
+		"bad.csv":  "name,port:int\nweb-001,80\nweb-002,http\n",
+	})
+
+	tests := []struct {
+		file string
+		want string // location prefix
+		line string // marked excerpt line
+	}{
+		{file: "bad.yaml", want: "bad.yaml:3:3: failed to parse YAML", line: ">    3 |   type: web"},
+		{file: "bad.json", want: "bad.json:2:24: failed to parse JSON", line: `>    2 |   "web-001": {"ip": 1,}`},
+		{file: "bad.toml", want: "bad.toml:2:6: failed to parse TOML", line: ">    2 | ip = "},
+		{file: "bad.hcl", want: "bad.hcl:3:10: failed to parse HCL", line: ">    3 |   port = = 80"},
+		{file: "bad.csv", want: "bad.csv:3:9: failed to parse CSV: column port", line: ">    3 | web-002,http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			_, err := loadVarsFile(path, detectVarsFormat(path, ""), LoadOptions{})
+			if err == nil {
+				t.Fatal("loadVarsFile() succeeded, want error")
+			}
+			if !strings.HasPrefix(err.Error(), filepath.Join(dir, tt.want)) {
+				t.Errorf("error = %q, want prefix %q", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.line) {
+				t.Errorf("error = %q, want excerpt line %q", err, tt.line)
+			}
+		})
+	}
+}
+
+func TestSourceExcerpt(t *testing.T) {
+	data := []byte("a: 1\nb: 2\nc: 3\n\td: [4\n")
+	want := "     2 | b: 2\n" +
+		"     3 | c: 3\n" +
+		">    4 | \td: [4\n" +
+		"       | \t   ^"
+
+	if got := sourceExcerpt(data, 4, 5); got != want {
+		t.Errorf("sourceExcerpt() =\n%s\nwant\n%s", got, want)
+	}
+	if got := sourceExcerpt(data, 9, 1); got != "" {
+		t.Errorf("sourceExcerpt() past the end = %q, want empty", got)
+	}
+}
+
+// Template failures are reported at the mapping field that failed
+func TestTemplateErrorPosition(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"mapping.yaml": `operations:
+  - type: Service
+    template:
+      Node: "{{ .Key }}"
+      Service:
+        Service: web
+        Tags:
+          - web
+          - "{{ .Value.meta.env.name }}"
+`,
+	})
+
+	mapping, err := loadMapping(filepath.Join(dir, "mapping.yaml"))
+	if err != nil {
+		t.Fatalf("loadMapping() error = %v", err)
+	}
+
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(output)
+
+	ctx := ExecutionContext{Key: "web-001", Value: map[string]interface{}{"meta": "flat"}}
+	if _, err := GenerateOperations(ctx, mapping); err != nil {
+		t.Fatalf("GenerateOperations() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"mapping.yaml:9:13: template processing failed: failed to process template.Service.Tags[1]",
+		`>    9 |           - "{{ .Value.meta.env.name }}"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log = %q, want %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ProtectConfig lists catalog entries the tool must never modify, whatever
+// the vars say. Each entry protects on its own.
+type ProtectConfig struct {
+	Action   string   `yaml:"action"`    // drop (default) or fail
+	Nodes    []string `yaml:"nodes"`     // Node name globs
+	Services []string `yaml:"services"`  // Service name or ID globs
+	NodeMeta []string `yaml:"node_meta"` // key=value selectors, value may be a glob
+}
+
+// validate checks the action and every pattern up front so a typo cannot
+// silently disable protection.
+func (p ProtectConfig) validate() error {
+	if p.Action != "" && p.Action != "drop" && p.Action != "fail" {
+		return fmt.Errorf("invalid protect action %q (expected drop or fail)", p.Action)
+	}
+
+	patterns := append(append([]string{}, p.Nodes...), p.Services...)
+	for _, selector := range p.NodeMeta {
+		key, value, ok := strings.Cut(selector, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid protect node_meta selector %q (expected key=value)", selector)
+		}
+		patterns = append(patterns, value)
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid protect pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (p ProtectConfig) empty() bool {
+	return len(p.Nodes) == 0 && len(p.Services) == 0 && len(p.NodeMeta) == 0
+}
+
+// protectCatalog is what the catalog holds for protection rules that
+// depend on more than the operations of this run.
+type protectCatalog struct {
+	Meta     map[string]map[string]string // Node meta of every catalog node
+	Services map[string][]string          // Service names and IDs of nodes this run deletes
+}
+
+// protectOperations removes operations that would touch a protected entry,
+// or fails listing all of them when the action is "fail". Node meta comes
+// from the Node operations of this run, plus the catalog when available.
+// Deleting a node also deletes its services, so a Node delete is protected
+// when the catalog lists a protected service on that node.
+func protectOperations(operations []map[string]interface{}, protect ProtectConfig, catalog protectCatalog) ([]map[string]interface{}, error) {
+	if protect.empty() {
+		return operations, nil
+	}
+
+	nodeMeta := collectNodeMeta(operations, catalog.Meta)
+
+	kept := make([]map[string]interface{}, 0, len(operations))
+	var blocked []string
+
+	for i, op := range operations {
+		reason := protectedReason(op, protect, nodeMeta, catalog.Services)
+		if reason == "" {
+			kept = append(kept, op)
+			continue
+		}
+
+		opType, verb, node := describeOperation(op)
+		message := fmt.Sprintf("operation %d (%s %s on %s): %s", i+1, verb, opType, node, reason)
+		if protect.Action == "fail" {
+			blocked = append(blocked, message)
+			continue
+		}
+		log.Printf("[WARN] Dropping protected %s", message)
+	}
+
+	if len(blocked) > 0 {
+		for _, message := range blocked {
+			log.Printf("[ERROR] Protected %s", message)
+		}
+		return nil, fmt.Errorf("%d operations touch protected entries", len(blocked))
+	}
+
+	if dropped := len(operations) - len(kept); dropped > 0 {
+		log.Printf("[INFO] Dropped %d operations on protected entries", dropped)
+	}
+
+	return kept, nil
+}
+
+// protectedReason explains why an operation is protected, or returns "".
+func protectedReason(op map[string]interface{}, protect ProtectConfig, nodeMeta map[string]map[string]string, nodeServices map[string][]string) string {
+	opType, verb, node := describeOperation(op)
+
+	if reason := protect.nodeReason(node, nodeMeta[node]); reason != "" {
+		return reason
+	}
+	if opType == "Node" && isDeleteVerb(verb) {
+		if reason := protect.serviceReason(nodeServices[node]); reason != "" {
+			return "node hosts " + reason
+		}
+	}
+	return protect.serviceReason(operationServiceNames(op))
+}
+
+// nodeReason explains why a node with the given meta is protected, or
+// returns "".
+func (p ProtectConfig) nodeReason(node string, meta map[string]string) string {
+	for _, pattern := range p.Nodes {
+		if matched, _ := path.Match(pattern, node); matched {
+			return fmt.Sprintf("node matches %q", pattern)
+		}
+	}
+
+	for _, selector := range p.NodeMeta {
+		key, pattern, _ := strings.Cut(selector, "=")
+		value, ok := meta[key]
+		if !ok {
+			continue
+		}
+		if matched, _ := path.Match(pattern, value); matched {
+			return fmt.Sprintf("node meta matches %q", selector)
+		}
+	}
+
+	return ""
+}
+
+// serviceReason explains why a service known by any of names (name or ID)
+// is protected, or returns "".
+func (p ProtectConfig) serviceReason(names []string) string {
+	for _, name := range names {
+		for _, pattern := range p.Services {
+			if matched, _ := path.Match(pattern, name); matched {
+				return fmt.Sprintf("service %q matches %q", name, pattern)
+			}
+		}
+	}
+	return ""
+}
+
+// operationServiceNames returns the service name and ID a Service operation
+// targets, or the service a Check operation is attached to.
+func operationServiceNames(op map[string]interface{}) []string {
+	var names []string
+
+	if svcOp, ok := op["Service"].(map[string]interface{}); ok {
+		service, _ := svcOp["Service"].(map[string]interface{})
+		for _, field := range []string{"Service", "ID"} {
+			if name, _ := service[field].(string); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if checkOp, ok := op["Check"].(map[string]interface{}); ok {
+		check, _ := checkOp["Check"].(map[string]interface{})
+		for _, field := range []string{"ServiceName", "ServiceID"} {
+			if name, _ := check[field].(string); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// collectNodeMeta gathers node meta from the catalog, overlaid with the meta
+// of Node operations in this run.
+func collectNodeMeta(operations []map[string]interface{}, catalogMeta map[string]map[string]string) map[string]map[string]string {
+	nodeMeta := make(map[string]map[string]string, len(catalogMeta))
+	for node, meta := range catalogMeta {
+		nodeMeta[node] = meta
+	}
+
+	for _, op := range operations {
+		nodeOp, ok := op["Node"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		data, _ := nodeOp["Node"].(map[string]interface{})
+		node, _ := data["Node"].(string)
+		meta, _ := data["Meta"].(map[string]interface{})
+		if node == "" || meta == nil {
+			continue
+		}
+
+		merged := map[string]string{}
+		for k, v := range nodeMeta[node] {
+			merged[k] = v
+		}
+		for k, v := range meta {
+			merged[k] = fmt.Sprint(v)
+		}
+		nodeMeta[node] = merged
+	}
+
+	return nodeMeta
+}
+
+// fetchProtectCatalog reads the catalog entries protect needs: the meta of
+// every node for node_meta selectors, and the services of each node deleted
+// by operations for service patterns. Nothing is read when no rule needs it.
+func fetchProtectCatalog(consulAddr, datacenter string, protect ProtectConfig, operations []map[string]interface{}) (protectCatalog, error) {
+	var catalog protectCatalog
+	client := &http.Client{
+		Timeout: defaultTimeout,
+	}
+
+	if len(protect.NodeMeta) > 0 {
+		nodes, err := fetchCatalogNodes(client, consulAddr, datacenter)
+		if err != nil {
+			return protectCatalog{}, err
+		}
+		catalog.Meta = make(map[string]map[string]string, len(nodes))
+		for _, node := range nodes {
+			catalog.Meta[node.Node] = node.Meta
+		}
+	}
+
+	if len(protect.Services) == 0 {
+		return catalog, nil
+	}
+
+	query := url.Values{"dc": {datacenter}}
+	for _, op := range operations {
+		opType, verb, node := describeOperation(op)
+		if opType != "Node" || !isDeleteVerb(verb) || node == "" {
+			continue
+		}
+		if _, ok := catalog.Services[node]; ok {
+			continue
+		}
+
+		var services catalogNodeServices
+		if err := getJSON(client, consulAddr, "/v1/catalog/node/"+url.PathEscape(node), query, &services); err != nil {
+			return protectCatalog{}, fmt.Errorf("failed to read services of node %s: %w", node, err)
+		}
+		if catalog.Services == nil {
+			catalog.Services = make(map[string][]string)
+		}
+		names := []string{}
+		for _, service := range services.Services {
+			names = append(names, service.Service, service.ID)
+		}
+		catalog.Services[node] = names
+	}
+
+	return catalog, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Protected entries are never modified
+func TestProtectOperations(t *testing.T) {
+	operations := []map[string]interface{}{
+		{"Node": map[string]interface{}{"Verb": "set", "Node": map[string]interface{}{"Node": "web-001", "Meta": map[string]interface{}{"owner": "web"}}}},
+		{"Node": map[string]interface{}{"Verb": "set", "Node": map[string]interface{}{"Node": "consul-server-1"}}},
+		{"Service": map[string]interface{}{"Verb": "set", "Node": "web-001", "Service": map[string]interface{}{"Service": "consul"}}},
+		{"Service": map[string]interface{}{"Verb": "set", "Node": "esm-01", "Service": map[string]interface{}{"Service": "nginx"}}},
+		{"Check": map[string]interface{}{"Verb": "set", "Node": "web-001", "Check": map[string]interface{}{"Name": "http", "ServiceID": "consul"}}},
+		{"Service": map[string]interface{}{"Verb": "set", "Node": "web-001", "Service": map[string]interface{}{"Service": "nginx"}}},
+	}
+
+	catalogMeta := map[string]map[string]string{
+		"esm-01": {"external-node": "true"},
+	}
+
+	protect := ProtectConfig{
+		Nodes:    []string{"consul-server-*"},
+		Services: []string{"consul"},
+		NodeMeta: []string{"external-node=true"},
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		got, err := protectOperations(operations, protect, protectCatalog{Meta: catalogMeta})
+		if err != nil {
+			t.Fatalf("protectOperations() error = %v", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("protectOperations() kept %d operations, want 2", len(got))
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		failing := protect
+		failing.Action = "fail"
+		if _, err := protectOperations(operations, failing, protectCatalog{Meta: catalogMeta}); err == nil {
+			t.Error("protectOperations() expected error for protected operations")
+		}
+	})
+
+	t.Run("generated meta", func(t *testing.T) {
+		byOwner := ProtectConfig{NodeMeta: []string{"owner=w*"}}
+		got, err := protectOperations(operations, byOwner, protectCatalog{})
+		if err != nil {
+			t.Fatalf("protectOperations() error = %v", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("protectOperations() kept %d operations, want 2", len(got))
+		}
+	})
+}
+
+// Deleting a node deletes its services, so it is protected when the catalog
+// lists a protected service on it
+func TestProtectNodeDeleteWithServices(t *testing.T) {
+	operations := []map[string]interface{}{
+		{"Node": map[string]interface{}{"Verb": "delete", "Node": map[string]interface{}{"Node": "web-001"}}},
+		{"Node": map[string]interface{}{"Verb": "delete", "Node": map[string]interface{}{"Node": "web-002"}}},
+		{"Node": map[string]interface{}{"Verb": "set", "Node": map[string]interface{}{"Node": "web-003"}}},
+	}
+	catalog := protectCatalog{Services: map[string][]string{
+		"web-001": {"consul", "consul"},
+		"web-002": {"nginx", "nginx-1"},
+		"web-003": {"consul", "consul"},
+	}}
+
+	got, err := protectOperations(operations, ProtectConfig{Services: []string{"consul"}}, catalog)
+	if err != nil {
+		t.Fatalf("protectOperations() error = %v", err)
+	}
+	var kept []string
+	for _, op := range got {
+		_, _, node := describeOperation(op)
+		kept = append(kept, node)
+	}
+	if want := []string{"web-002", "web-003"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("protectOperations() kept %v, want %v", kept, want)
+	}
+}
+
+func TestProtectConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		protect ProtectConfig
+		wantErr bool
+	}{
+		{name: "empty", protect: ProtectConfig{}},
+		{name: "valid", protect: ProtectConfig{Action: "fail", Nodes: []string{"esm-*"}, NodeMeta: []string{"owner=ops"}}},
+		{name: "unknown action", protect: ProtectConfig{Action: "skip"}, wantErr: true},
+		{name: "bad glob", protect: ProtectConfig{Services: []string{"[web"}}, wantErr: true},
+		{name: "bad selector", protect: ProtectConfig{NodeMeta: []string{"owner"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.protect.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// SafetyThresholds are guardrails checked before any transaction is sent.
+// Negative maximums and a zero minimum disable the respective check.
+type SafetyThresholds struct {
+	MaxDeletes       int
+	MaxDeletePercent float64
+	MaxNodesChanged  int
+	MinOpsPercent    float64
+}
+
+// operationStats summarizes what a run is about to change.
+type operationStats struct {
+	Total        int
+	Deletes      int
+	Registers    int // Node and Service set operations
+	NodesChanged int
+}
+
+// EnforceSafetyThresholds returns an error listing every tripped threshold,
+// unless force is set, in which case they are only logged. Catalog entries
+// covered by protect are left out of the -min-ops-percent baseline, since
+// the run may never register them.
+func EnforceSafetyThresholds(consulAddr, datacenter string, operations []map[string]interface{}, protect ProtectConfig, thresholds SafetyThresholds, force bool) error {
+	stats := summarizeOperations(operations)
+
+	catalogSize := 0
+	if thresholds.MinOpsPercent > 0 {
+		size, err := fetchCatalogSize(consulAddr, datacenter, protect)
+		if err != nil {
+			return fmt.Errorf("failed to read current catalog: %w", err)
+		}
+		catalogSize = size
+	}
+
+	violations := checkSafetyThresholds(stats, catalogSize, thresholds)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	for _, v := range violations {
+		if force {
+			log.Printf("[WARN] Safety threshold exceeded (ignored by -force): %s", v)
+		} else {
+			log.Printf("[ERROR] Safety threshold exceeded: %s", v)
+		}
+	}
+
+	if force {
+		return nil
+	}
+
+	return fmt.Errorf("%d safety threshold(s) exceeded, use -force to apply anyway: %s", len(violations), strings.Join(violations, "; "))
+}
+
+func summarizeOperations(operations []map[string]interface{}) operationStats {
+	stats := operationStats{Total: len(operations)}
+	nodes := map[string]bool{}
+
+	for _, op := range operations {
+		opType, verb, node := describeOperation(op)
+		if node != "" {
+			nodes[node] = true
+		}
+
+		if isDeleteVerb(verb) {
+			stats.Deletes++
+		} else if opType == "Node" || opType == "Service" {
+			stats.Registers++
+		}
+	}
+
+	stats.NodesChanged = len(nodes)
+	return stats
+}
+
+// checkSafetyThresholds describes each threshold the stats trip. catalogSize
+// is the number of unprotected nodes plus service instances currently
+// registered.
+func checkSafetyThresholds(stats operationStats, catalogSize int, thresholds SafetyThresholds) []string {
+	var violations []string
+
+	if thresholds.MaxDeletes >= 0 && stats.Deletes > thresholds.MaxDeletes {
+		violations = append(violations, fmt.Sprintf("%d deletions exceed -max-deletes %d", stats.Deletes, thresholds.MaxDeletes))
+	}
+
+	if thresholds.MaxDeletePercent >= 0 && stats.Total > 0 {
+		percent := float64(stats.Deletes) * 100 / float64(stats.Total)
+		if percent > thresholds.MaxDeletePercent {
+			violations = append(violations, fmt.Sprintf("deletions are %.1f%% of operations, above -max-delete-percent %g", percent, thresholds.MaxDeletePercent))
+		}
+	}
+
+	if thresholds.MaxNodesChanged >= 0 && stats.NodesChanged > thresholds.MaxNodesChanged {
+		violations = append(violations, fmt.Sprintf("%d nodes changed exceed -max-nodes-changed %d", stats.NodesChanged, thresholds.MaxNodesChanged))
+	}
+
+	if thresholds.MinOpsPercent > 0 && catalogSize > 0 {
+		percent := float64(stats.Registers) * 100 / float64(catalogSize)
+		if percent < thresholds.MinOpsPercent {
+			violations = append(violations, fmt.Sprintf("%d node/service registrations are %.1f%% of %d catalog entries, below -min-ops-percent %g", stats.Registers, percent, catalogSize, thresholds.MinOpsPercent))
+		}
+	}
+
+	return violations
+}
+
+// catalogFetchWorkers bounds the concurrent requests made to size the
+// catalog
+const catalogFetchWorkers = 8
+
+// catalogNodeServices is the part of /v1/catalog/node/:node that is needed
+type catalogNodeServices struct {
+	Services map[string]struct {
+		ID      string `json:"ID"`
+		Service string `json:"Service"`
+	} `json:"Services"`
+}
+
+// fetchCatalogSize counts the nodes and service instances registered in the
+// datacenter that protect leaves the run free to change. Nodes are listed
+// once, then the services of each unprotected node are read with at most
+// catalogFetchWorkers requests in flight.
+func fetchCatalogSize(consulAddr, datacenter string, protect ProtectConfig) (int, error) {
+	client := &http.Client{
+		Timeout: defaultTimeout,
+	}
+
+	nodes, err := fetchCatalogNodes(client, consulAddr, datacenter)
+	if err != nil {
+		return 0, err
+	}
+
+	var names []string
+	for _, node := range nodes {
+		if protect.nodeReason(node.Node, node.Meta) == "" {
+			names = append(names, node.Node)
+		}
+	}
+
+	query := url.Values{"dc": {datacenter}}
+	results := make([]catalogNodeServices, len(names))
+	errs := make([]error, len(names))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(catalogFetchWorkers, len(names)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = getJSON(client, consulAddr, "/v1/catalog/node/"+url.PathEscape(names[i]), query, &results[i])
+			}
+		}()
+	}
+
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return 0, fmt.Errorf("failed to read services of node %s: %w", names[i], err)
+		}
+	}
+
+	return countCatalogEntries(results, protect), nil
+}
+
+// countCatalogEntries counts the given unprotected nodes and their service
+// instances that are not protected themselves.
+func countCatalogEntries(nodes []catalogNodeServices, protect ProtectConfig) int {
+	size := len(nodes)
+	for _, node := range nodes {
+		for _, service := range node.Services {
+			if protect.serviceReason([]string{service.Service, service.ID}) == "" {
+				size++
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Guardrails evaluated before syncing
+func TestCheckSafetyThresholds(t *testing.T) {
+	operations := []map[string]interface{}{
+		{"Node": map[string]interface{}{"Verb": "set", "Node": map[string]interface{}{"Node": "web-001"}}},
+		{"Service": map[string]interface{}{"Verb": "set", "Node": "web-001", "Service": map[string]interface{}{"ID": "nginx"}}},
+		{"Node": map[string]interface{}{"Verb": "delete", "Node": map[string]interface{}{"Node": "web-002"}}},
+		{"Service": map[string]interface{}{"Verb": "delete", "Node": "web-003", "Service": map[string]interface{}{"ID": "old"}}},
+	}
+
+	stats := summarizeOperations(operations)
+	if stats.Total != 4 || stats.Deletes != 2 || stats.Registers != 2 || stats.NodesChanged != 3 {
+		t.Fatalf("summarizeOperations() = %+v", stats)
+	}
+
+	disabled := SafetyThresholds{MaxDeletes: -1, MaxDeletePercent: -1, MaxNodesChanged: -1}
+
+	tests := []struct {
+		name        string
+		thresholds  func(SafetyThresholds) SafetyThresholds
+		catalogSize int
+		want        int
+	}{
+		{
+			name:       "all disabled",
+			thresholds: func(s SafetyThresholds) SafetyThresholds { return s },
+			want:       0,
+		},
+		{
+			name:       "too many deletes",
+			thresholds: func(s SafetyThresholds) SafetyThresholds { s.MaxDeletes = 1; return s },
+			want:       1,
+		},
+		{
+			name:       "delete percentage at limit",
+			thresholds: func(s SafetyThresholds) SafetyThresholds { s.MaxDeletePercent = 50; return s },
+			want:       0,
+		},
+		{
+			name:       "no deletes allowed and too many nodes",
+			thresholds: func(s SafetyThresholds) SafetyThresholds { s.MaxDeletes = 0; s.MaxNodesChanged = 2; return s },
+			want:       2,
+		},
+		{
+			name:        "too few registrations for catalog",
+			thresholds:  func(s SafetyThresholds) SafetyThresholds { s.MinOpsPercent = 50; return s },
+			catalogSize: 10,
+			want:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkSafetyThresholds(stats, tt.catalogSize, tt.thresholds(disabled))
+			if len(got) != tt.want {
+				t.Errorf("checkSafetyThresholds() = %v, want %d violations", got, tt.want)
+			}
+		})
+	}
+}
+
+// Protected services are left out of the -min-ops-percent baseline
+func TestCountCatalogEntries(t *testing.T) {
+	var nodes []catalogNodeServices
+	for _, node := range []string{
+		`{"Services": {"nginx": {"ID": "nginx", "Service": "nginx"}, "consul": {"ID": "consul", "Service": "consul"}}}`,
+		`{"Services": {"web-1": {"ID": "web-1", "Service": "web"}, "web-2": {"ID": "web-2", "Service": "web"}}}`,
+		`{"Services": null}`,
+	} {
+		var services catalogNodeServices
+		if err := json.Unmarshal([]byte(node), &services); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, services)
+	}
+
+	tests := []struct {
+		name    string
+		protect ProtectConfig
+		want    int
+	}{
+		{name: "no protection", want: 7},
+		{name: "protected service name", protect: ProtectConfig{Services: []string{"consul"}}, want: 6},
+		{name: "protected service ID", protect: ProtectConfig{Services: []string{"web-2"}}, want: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countCatalogEntries(nodes, tt.protect); got != tt.want {
+				t.Errorf("countCatalogEntries() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
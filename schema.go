@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaConfig describes the fields of a node. Every loaded node is checked
+// against it before any operation is generated.
+type SchemaConfig struct {
+	Fields      map[string]FieldSpec `yaml:"fields"`       // Dotted field path -> spec
+	DenyUnknown bool                 `yaml:"deny_unknown"` // Reject fields not listed in Fields
+
+	patterns map[string]*regexp.Regexp
+}
+
+// FieldSpec constrains a single field
+type FieldSpec struct {
+	Type     string   `yaml:"type"`     // string, int, number, bool, list or map; empty for any
+	Required bool     `yaml:"required"` // The field must be present
+	Enum     []string `yaml:"enum"`     // Allowed values, compared as strings
+	Pattern  string   `yaml:"pattern"`  // Regular expression the value must match
+}
+
+var schemaTypes = map[string]bool{"": true, "string": true, "int": true, "number": true, "bool": true, "list": true, "map": true}
+
+// validate checks the spec itself and compiles its patterns.
+func (s *SchemaConfig) validate() error {
+	s.patterns = make(map[string]*regexp.Regexp)
+
+	for field, spec := range s.Fields {
+		if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+			return fmt.Errorf("invalid schema field %q", field)
+		}
+		if !schemaTypes[spec.Type] {
+			return fmt.Errorf("invalid schema type %q for %s (expected string, int, number, bool, list or map)", spec.Type, field)
+		}
+		if spec.Pattern != "" {
+			re, err := regexp.Compile(spec.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid schema pattern for %s: %w", field, err)
+			}
+			s.patterns[field] = re
+		}
+	}
+
+	return nil
+}
+
+func (s *SchemaConfig) empty() bool {
+	return len(s.Fields) == 0 && !s.DenyUnknown
+}
+
+// validateVars checks every node against the schema and fails listing all
+// violations, each with the file the node was loaded from.
+func validateVars(vars map[string]interface{}, sources map[string]NodeSource, schema *SchemaConfig) error {
+	if schema.empty() {
+		return nil
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var violations []string
+	for _, key := range keys {
+		for _, problem := range schema.check(vars[key]) {
+			violations = append(violations, fmt.Sprintf("%s: node '%s': %s", sources[key].Path, key, problem))
+		}
+	}
+
+	if len(violations) == 0 {
+		log.Printf("[INFO] All %d nodes match the schema", len(vars))
+		return nil
+	}
+
+	for _, violation := range violations {
+		log.Printf("[ERROR] Schema violation in %s", violation)
+	}
+	return fmt.Errorf("%d schema violations found", len(violations))
+}
+
+// check returns the violations of a single node, sorted by field.
+func (s *SchemaConfig) check(value interface{}) []string {
+	node, ok := value.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("node is a %s, not a map", typeName(value))}
+	}
+
+	fields := make([]string, 0, len(s.Fields))
+	for field := range s.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var problems []string
+	for _, field := range fields {
+		spec := s.Fields[field]
+		current, ok := lookupPath(node, strings.Split(field, "."))
+		if !ok {
+			if spec.Required {
+				problems = append(problems, fmt.Sprintf("missing required field %s", field))
+			}
+			continue
+		}
+		if problem := s.checkField(field, spec, current); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if s.DenyUnknown {
+		problems = append(problems, s.unknownFields(node, "")...)
+	}
+
+	return problems
+}
+
+func (s *SchemaConfig) checkField(field string, spec FieldSpec, value interface{}) string {
+	if !matchesType(spec.Type, value) {
+		return fmt.Sprintf("field %s is a %s, expected %s", field, typeName(value), spec.Type)
+	}
+
+	text := fmt.Sprint(value)
+	if len(spec.Enum) > 0 {
+		allowed := false
+		for _, candidate := range spec.Enum {
+			if candidate == text {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("field %s is %q, expected one of %s", field, text, strings.Join(spec.Enum, ", "))
+		}
+	}
+
+	if re := s.patterns[field]; re != nil && !re.MatchString(text) {
+		return fmt.Sprintf("field %s is %q, which does not match %s", field, text, spec.Pattern)
+	}
+
+	return ""
+}
+
+// unknownFields reports fields that are neither listed nor lead to a listed
+// field. Listed fields are not descended into unless deeper fields are
+// listed too.
+func (s *SchemaConfig) unknownFields(node map[string]interface{}, prefix string) []string {
+	keys := make([]string, 0, len(node))
+	for key := range node {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		field := prefix + key
+		_, listed := s.Fields[field]
+		parent := s.hasChildren(field)
+
+		if !listed && !parent {
+			problem := fmt.Sprintf("unknown field %s", field)
+			if suggestion := s.suggest(field); suggestion != "" {
+				problem += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			problems = append(problems, problem)
+			continue
+		}
+
+		if child, ok := node[key].(map[string]interface{}); ok && parent {
+			problems = append(problems, s.unknownFields(child, field+".")...)
+		}
+	}
+	return problems
+}
+
+func (s *SchemaConfig) hasChildren(field string) bool {
+	for listed := range s.Fields {
+		if strings.HasPrefix(listed, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the listed field closest to a misspelled one, if any is
+// within two edits.
+func (s *SchemaConfig) suggest(field string) string {
+	best, bestDistance := "", 3
+	for listed := range s.Fields {
+		d := editDistance(field, listed)
+		if d < bestDistance || (d == bestDistance && listed < best) {
+			best, bestDistance = listed, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "":
+		return true
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "list":
+		_, ok := value.([]interface{})
+		return ok
+	case "map":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "int":
+		switch v := value.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			// JSON numbers decode as float64
+			return v == math.Trunc(v)
+		}
+		return false
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int64, uint64:
+		return "int"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaCheck(t *testing.T) {
+	schema := SchemaConfig{
+		DenyUnknown: true,
+		Fields: map[string]FieldSpec{
+			"ip":         {Type: "string", Required: true, Pattern: `^\d+\.\d+\.\d+\.\d+$`},
+			"port":       {Type: "int"},
+			"env":        {Enum: []string{"prod", "staging"}},
+			"tags":       {Type: "list"},
+			"meta.owner": {Type: "string", Required: true},
+		},
+	}
+	if err := schema.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		node interface{}
+		want []string
+	}{
+		{
+			name: "valid",
+			node: map[string]interface{}{"ip": "10.0.0.1", "port": uint64(80), "env": "prod", "meta": map[string]interface{}{"owner": "web"}},
+		},
+		{
+			name: "json numbers",
+			node: map[string]interface{}{"ip": "10.0.0.1", "port": float64(80), "meta": map[string]interface{}{"owner": "web"}},
+		},
+		{
+			name: "violations",
+			node: map[string]interface{}{"ip": "web", "port": "80", "env": "dev", "tags": "web"},
+			want: []string{
+				`field env is "dev", expected one of prod, staging`,
+				`field ip is "web", which does not match ^\d+\.\d+\.\d+\.\d+$`,
+				"missing required field meta.owner",
+				"field port is a string, expected int",
+				"field tags is a string, expected list",
+			},
+		},
+		{
+			name: "unknown fields",
+			node: map[string]interface{}{"ip": "10.0.0.1", "prot": uint64(80), "meta": map[string]interface{}{"owner": "web", "rack": "r1"}},
+			want: []string{
+				"unknown field meta.rack",
+				"unknown field prot (did you mean port?)",
+			},
+		},
+		{
+			name: "not a map",
+			node: "10.0.0.1",
+			want: []string{"node is a string, not a map"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schema.check(tt.node)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]FieldSpec
+		want   string
+	}{
+		{name: "bad type", fields: map[string]FieldSpec{"port": {Type: "integer"}}, want: `invalid schema type "integer" for port`},
+		{name: "bad pattern", fields: map[string]FieldSpec{"ip": {Pattern: "["}}, want: "invalid schema pattern for ip"},
+		{name: "bad field", fields: map[string]FieldSpec{"meta.": {}}, want: `invalid schema field "meta."`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := SchemaConfig{Fields: tt.fields}
+			err := schema.validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateVars(t *testing.T) {
+	schema := SchemaConfig{Fields: map[string]FieldSpec{"ip": {Required: true}}}
+	if err := schema.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	vars := map[string]interface{}{
+		"web-001": map[string]interface{}{"ip": "10.0.0.1"},
+		"web-002": map[string]interface{}{},
+		"web-003": map[string]interface{}{},
+	}
+	sources := map[string]NodeSource{
+		"web-002": {Path: "vars/web.yaml"},
+		"web-003": {Path: "vars/web.yaml"},
+	}
+
+	err := validateVars(vars, sources, &schema)
+	if err == nil || err.Error() != "2 schema violations found" {
+		t.Errorf("validateVars() error = %v, want 2 violations", err)
+	}
+
+	if err := validateVars(vars, sources, &SchemaConfig{}); err != nil {
+		t.Errorf("validateVars() without schema error = %v", err)
+	}
+}
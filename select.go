@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// NodeSelector restricts a run to a subset of the loaded nodes. All
+// configured filters must match; an empty selector matches every node.
+type NodeSelector struct {
+	Keys    []keyPattern     // -limit: any pattern may match the node key
+	Fields  []fieldCondition // -select: every condition must hold
+	Sources []string         // -limit-source: any glob may match the source file
+}
+
+// keyPattern is a node key glob, or a regular expression when written as ~regex
+type keyPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// fieldCondition compares a (dotted) vars field against a glob
+type fieldCondition struct {
+	field  []string
+	negate bool
+	value  string
+}
+
+// parseNodeSelector builds a selector from the -limit, -select and
+// -limit-source flag values. Each flag may be repeated, and each value may
+// hold several comma-separated items.
+func parseNodeSelector(limit, selectExpr, limitSource []string) (*NodeSelector, error) {
+	selector := &NodeSelector{}
+
+	for _, pattern := range splitLimitPatterns(limit) {
+		if strings.HasPrefix(pattern, "~") {
+			re, err := regexp.Compile(pattern[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid -limit regex %q: %w", pattern, err)
+			}
+			selector.Keys = append(selector.Keys, keyPattern{re: re})
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid -limit pattern %q: %w", pattern, err)
+		}
+		selector.Keys = append(selector.Keys, keyPattern{glob: pattern})
+	}
+
+	for _, expr := range splitValues(selectExpr) {
+		cond, err := parseFieldCondition(expr)
+		if err != nil {
+			return nil, err
+		}
+		selector.Fields = append(selector.Fields, cond)
+	}
+
+	for _, pattern := range splitValues(limitSource) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid -limit-source pattern %q: %w", pattern, err)
+		}
+		selector.Sources = append(selector.Sources, pattern)
+	}
+
+	return selector, nil
+}
+
+// splitLimitPatterns splits -limit values on commas, except that a ~regex
+// runs to the end of its value, so regular expressions may contain commas
+// as in ~^web-[0-9]{1,3}$. Repeat -limit to add patterns after a regex.
+func splitLimitPatterns(values []string) []string {
+	var patterns []string
+	for _, value := range values {
+		for value != "" {
+			item, rest, _ := strings.Cut(value, ",")
+			if strings.HasPrefix(strings.TrimSpace(item), "~") {
+				item, rest = value, ""
+			}
+			if item = strings.TrimSpace(item); item != "" {
+				patterns = append(patterns, item)
+			}
+			value = rest
+		}
+	}
+	return patterns
+}
+
+func splitValues(values []string) []string {
+	var items []string
+	for _, value := range values {
+		items = append(items, splitList(value)...)
+	}
+	return items
+}
+
+func parseFieldCondition(expr string) (fieldCondition, error) {
+	negate := false
+	field, value, ok := strings.Cut(expr, "!=")
+	if ok {
+		negate = true
+	} else {
+		field, value, ok = strings.Cut(expr, "=")
+	}
+
+	field = strings.TrimSpace(field)
+	if !ok || field == "" {
+		return fieldCondition{}, fmt.Errorf("invalid -select expression %q: expected field=value or field!=value", expr)
+	}
+
+	value = strings.TrimSpace(value)
+	if _, err := path.Match(value, ""); err != nil {
+		return fieldCondition{}, fmt.Errorf("invalid -select pattern %q: %w", expr, err)
+	}
+
+	return fieldCondition{field: strings.Split(field, "."), negate: negate, value: value}, nil
+}
+
+// Empty reports whether the selector lets every node through.
+func (s *NodeSelector) Empty() bool {
+	return len(s.Keys) == 0 && len(s.Fields) == 0 && len(s.Sources) == 0
+}
+
+// Match reports whether a node passes every configured filter.
+func (s *NodeSelector) Match(key string, value map[string]interface{}, source NodeSource) bool {
+	if len(s.Keys) > 0 && !s.matchKey(key) {
+		return false
+	}
+
+	for _, cond := range s.Fields {
+		if !cond.match(value) {
+			return false
+		}
+	}
+
+	if len(s.Sources) > 0 && !s.matchSource(source) {
+		return false
+	}
+
+	return true
+}
+
+// Count returns how many map nodes pass the selector.
+func (s *NodeSelector) Count(vars map[string]interface{}, sources map[string]NodeSource) int {
+	count := 0
+	for key, value := range vars {
+		if node, ok := value.(map[string]interface{}); ok && s.Match(key, node, sources[key]) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *NodeSelector) matchKey(key string) bool {
+	for _, p := range s.Keys {
+		if p.re != nil {
+			if p.re.MatchString(key) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(p.glob, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSource matches the source path relative to the vars directory, or any
+// of its parent directories, so "group1" selects everything below group1/.
+func (s *NodeSelector) matchSource(source NodeSource) bool {
+	rel := strings.ReplaceAll(source.Rel, "\\", "/")
+	for _, pattern := range s.Sources {
+		for candidate := rel; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match looks up the dotted field; a missing field never equals a value, so
+// env!=prod also selects nodes without an env field.
+func (c fieldCondition) match(value map[string]interface{}) bool {
+	current, ok := lookupPath(value, c.field)
+	if !ok {
+		return c.negate
+	}
+
+	matched, _ := path.Match(c.value, fmt.Sprint(current))
+	return matched != c.negate
+}
+
+// lookupPath follows a dotted field path through nested maps.
+func lookupPath(value map[string]interface{}, fields []string) (interface{}, bool) {
+	var current interface{} = value
+	for _, field := range fields {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+// Node selection for partial syncs
+func TestNodeSelectorMatch(t *testing.T) {
+	value := map[string]interface{}{
+		"type": "web",
+		"env":  "staging",
+		"meta": map[string]interface{}{"rack": "r3"},
+	}
+	source := NodeSource{Path: "vars/group1/items.yaml", Rel: "group1/items.yaml"}
+
+	tests := []struct {
+		name        string
+		limit       []string
+		selectExpr  []string
+		limitSource []string
+		key         string
+		want        bool
+	}{
+		{name: "empty selector", key: "web-001", want: true},
+		{name: "key glob", limit: []string{"db-*,web-*"}, key: "web-001", want: true},
+		{name: "key glob mismatch", limit: []string{"db-*"}, key: "web-001", want: false},
+		{name: "key regex", limit: []string{"~^web-0[0-9]+$"}, key: "web-001", want: true},
+		{name: "key regex with comma", limit: []string{"~^web-[0-9]{1,3}$"}, key: "web-001", want: true},
+		{name: "key regex after glob", limit: []string{"db-*,~^web-[0-9]{1,3}$"}, key: "web-001", want: true},
+		{name: "repeated limit", limit: []string{"~^db-[0-9]{1,3}$", "web-*"}, key: "web-001", want: true},
+		{name: "repeated select", selectExpr: []string{"type=web", "env=prod"}, key: "web-001", want: false},
+		{name: "repeated limit source", limitSource: []string{"group2", "group1"}, key: "web-001", want: true},
+		{name: "field equals", selectExpr: []string{"type=web"}, key: "web-001", want: true},
+		{name: "field not equals", selectExpr: []string{"type=web,env!=prod"}, key: "web-001", want: true},
+		{name: "field mismatch", selectExpr: []string{"type=web,env=prod"}, key: "web-001", want: false},
+		{name: "missing field not equals", selectExpr: []string{"owner!=ops"}, key: "web-001", want: true},
+		{name: "missing field equals", selectExpr: []string{"owner=ops"}, key: "web-001", want: false},
+		{name: "nested field glob", selectExpr: []string{"meta.rack=r*"}, key: "web-001", want: true},
+		{name: "source directory", limitSource: []string{"group1"}, key: "web-001", want: true},
+		{name: "source file glob", limitSource: []string{"group*/items.yaml"}, key: "web-001", want: true},
+		{name: "source mismatch", limitSource: []string{"group2"}, key: "web-001", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := parseNodeSelector(tt.limit, tt.selectExpr, tt.limitSource)
+			if err != nil {
+				t.Fatalf("parseNodeSelector() error = %v", err)
+			}
+			if got := selector.Match(tt.key, value, source); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNodeSelectorErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       []string
+		selectExpr  []string
+		limitSource []string
+	}{
+		{name: "bad regex", limit: []string{"~web-("}},
+		{name: "bad glob", limit: []string{"[web"}},
+		{name: "missing operator", selectExpr: []string{"type"}},
+		{name: "missing field", selectExpr: []string{"=web"}},
+		{name: "bad source glob", limitSource: []string{"[group"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseNodeSelector(tt.limit, tt.selectExpr, tt.limitSource); err == nil {
+				t.Error("parseNodeSelector() expected error")
+			}
+		})
+	}
+}
+
+func TestNodeSelectorCount(t *testing.T) {
+	vars := map[string]interface{}{
+		"web-001": map[string]interface{}{"type": "web"},
+		"web-002": map[string]interface{}{"type": "web"},
+		"db-001":  map[string]interface{}{"type": "db"},
+	}
+
+	tests := []struct {
+		limit []string
+		want  int
+	}{
+		{limit: nil, want: 3},
+		{limit: []string{"~^web-[0-9]{1,3}$"}, want: 2},
+		{limit: []string{"db-*", "web-002"}, want: 2},
+		{limit: []string{"cache-*"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		selector, err := parseNodeSelector(tt.limit, nil, nil)
+		if err != nil {
+			t.Fatalf("parseNodeSelector(%q) error = %v", tt.limit, err)
+		}
+		if got := selector.Count(vars, nil); got != tt.want {
+			t.Errorf("Count() with -limit %q = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
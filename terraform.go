@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// terraformState is the subset of a version 4 state file that is needed
+type terraformState struct {
+	Version   int                 `json:"version"`
+	Resources []terraformResource `json:"resources"`
+}
+
+type terraformResource struct {
+	Module    string              `json:"module"`
+	Mode      string              `json:"mode"`
+	Type      string              `json:"type"`
+	Name      string              `json:"name"`
+	Instances []terraformInstance `json:"instances"`
+}
+
+type terraformInstance struct {
+	IndexKey   interface{}            `json:"index_key"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// terraformOutput is one entry of `terraform output -json`
+type terraformOutput struct {
+	Value interface{} `json:"value"`
+}
+
+// loadTerraform loads nodes from a local Terraform state file or a file
+// written by `terraform output -json`.
+//
+// For state files every managed resource instance whose type or address
+// matches opts.TFResources becomes a node holding its attributes plus
+// tf_address and tf_type. For output files every matching output whose
+// value is a map of objects contributes those objects, and a list of
+// objects contributes one node per element. Nodes are keyed by the
+// opts.TFKey attribute (dotted paths allowed), or by the instance address or
+// map key when it is empty.
+func loadTerraform(file, root string, opts LoadOptions, allVars map[string]interface{}, sources map[string]NodeSource) error {
+	log.Printf("[INFO] Loading Terraform data: %s", file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read Terraform file: %w", err)
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return withSource(file, data, jsonError(data, "failed to parse Terraform file", err))
+	}
+
+	var nodes map[string]interface{}
+	if isTerraformState(probe) {
+		nodes, err = terraformStateNodes(data, opts)
+	} else {
+		nodes, err = terraformOutputNodes(data, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load Terraform file %s: %w", file, err)
+	}
+
+	nodeCount, err := mergeVars(allVars, sources, nodes, nil, NodeSource{Root: root, Path: file, Rel: filepath.Base(file)}, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Loaded %d nodes", nodeCount)
+
+	return nil
+}
+
+// isTerraformState tells a state file from an output file, whose top-level
+// keys are output names and may be anything, including "resources". Every
+// state has a numeric version next to terraform_version and lineage.
+func isTerraformState(probe map[string]json.RawMessage) bool {
+	var version float64
+	if err := json.Unmarshal(probe["version"], &version); err != nil {
+		return false
+	}
+	_, hasTerraformVersion := probe["terraform_version"]
+	_, hasLineage := probe["lineage"]
+	return hasTerraformVersion || hasLineage
+}
+
+func terraformStateNodes(data []byte, opts LoadOptions) (map[string]interface{}, error) {
+	var state terraformState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("unsupported state version %d (expected 4)", state.Version)
+	}
+
+	nodes := make(map[string]interface{})
+	for _, res := range state.Resources {
+		if res.Mode != "managed" {
+			continue
+		}
+
+		for _, inst := range res.Instances {
+			address := terraformAddress(res, inst)
+			if !matchTerraformPatterns(opts.TFResources, res.Type, address) {
+				continue
+			}
+
+			attrs := make(map[string]interface{}, len(inst.Attributes)+2)
+			for k, v := range inst.Attributes {
+				attrs[k] = v
+			}
+			attrs["tf_address"] = address
+			attrs["tf_type"] = res.Type
+
+			addTerraformNode(nodes, attrs, address, opts)
+		}
+	}
+
+	return nodes, nil
+}
+
+func terraformOutputNodes(data []byte, opts LoadOptions) (map[string]interface{}, error) {
+	var outputs map[string]terraformOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nodes := make(map[string]interface{})
+	for _, name := range names {
+		if !matchTerraformPatterns(opts.TFResources, name, name) {
+			continue
+		}
+
+		switch value := outputs[name].Value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if attrs, ok := value[key].(map[string]interface{}); ok {
+					addTerraformNode(nodes, attrs, key, opts)
+				}
+			}
+
+		case []interface{}:
+			for i, item := range value {
+				if attrs, ok := item.(map[string]interface{}); ok {
+					addTerraformNode(nodes, attrs, fmt.Sprintf("%s[%d]", name, i), opts)
+				}
+			}
+
+		default:
+			log.Printf("[WARN] Skipping Terraform output %s: not a map or list of objects", name)
+		}
+	}
+
+	return nodes, nil
+}
+
+// addTerraformNode stores attrs under the value of the opts.TFKey attribute,
+// or under fallback when no key attribute is configured.
+func addTerraformNode(nodes map[string]interface{}, attrs map[string]interface{}, fallback string, opts LoadOptions) {
+	key := fallback
+	if opts.TFKey != "" {
+		value, ok := lookupPath(attrs, strings.Split(opts.TFKey, "."))
+		if !ok || value == nil || fmt.Sprint(value) == "" {
+			opts.warn("Skipping %s: no %s attribute", fallback, opts.TFKey)
+			return
+		}
+		key = fmt.Sprint(value)
+	}
+
+	if _, exists := nodes[key]; exists {
+		opts.warn("Duplicate node '%s' from %s (keeping first occurrence)", key, fallback)
+		return
+	}
+	nodes[key] = attrs
+}
+
+// terraformAddress builds the resource instance address, e.g.
+// module.net.aws_instance.web[0] or aws_instance.web["a"].
+func terraformAddress(res terraformResource, inst terraformInstance) string {
+	address := res.Type + "." + res.Name
+	if res.Module != "" {
+		address = res.Module + "." + address
+	}
+
+	switch key := inst.IndexKey.(type) {
+	case float64:
+		address += fmt.Sprintf("[%d]", int(key))
+	case string:
+		address += fmt.Sprintf("[%q]", key)
+	}
+
+	return address
+}
+
+// matchTerraformPatterns reports whether the type or address matches one
+// of the globs; no patterns match everything.
+func matchTerraformPatterns(patterns []string, typ, address string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, typ); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, address); matched {
+			return true
+		}
+	}
+	return false
+}
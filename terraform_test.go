@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Terraform state and output files as vars sources
+func TestLoadTerraform(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"terraform.tfstate": `{
+  "version": 4,
+  "terraform_version": "1.9.0",
+  "serial": 12,
+  "lineage": "8d2d4e63-3b51-4d8e-8f7b-1a2b3c4d5e6f",
+  "resources": [
+    {"mode": "data", "type": "aws_ami", "name": "base", "instances": [{"attributes": {"id": "ami-1"}}]},
+    {"mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+      {"index_key": 0, "attributes": {"private_ip": "10.0.0.1", "tags": {"Name": "web-001"}}},
+      {"index_key": 1, "attributes": {"private_ip": "10.0.0.2", "tags": {"Name": "web-002"}}}
+    ]},
+    {"mode": "managed", "module": "module.db", "type": "aws_instance", "name": "db", "instances": [
+      {"index_key": "primary", "attributes": {"private_ip": "10.0.1.1", "tags": {}}}
+    ]},
+    {"mode": "managed", "type": "aws_security_group", "name": "web", "instances": [{"attributes": {"id": "sg-1"}}]}
+  ]
+}`,
+		"outputs.json": `{
+  "hosts": {"sensitive": false, "type": "object", "value": {
+    "web-001": {"ip": "10.0.0.1"},
+    "web-002": {"ip": "10.0.0.2"}
+  }},
+  "region": {"sensitive": false, "type": "string", "value": "eu-west-1"}
+}`,
+		"resources.json": `{
+  "resources": {"sensitive": false, "type": "object", "value": {
+    "web-101": {"ip": "10.1.0.1"}
+  }},
+  "version": {"sensitive": false, "type": "number", "value": 4}
+}`,
+	})
+
+	tests := []struct {
+		name string
+		file string
+		opts LoadOptions
+		want []string
+	}{
+		{
+			name: "state by address",
+			file: "terraform.tfstate",
+			opts: LoadOptions{TFResources: []string{"aws_instance"}},
+			want: []string{`aws_instance.web[0]`, `aws_instance.web[1]`, `module.db.aws_instance.db["primary"]`},
+		},
+		{
+			name: "state keyed by tag",
+			file: "terraform.tfstate",
+			opts: LoadOptions{TFResources: []string{"aws_instance.web*"}, TFKey: "tags.Name"},
+			want: []string{"web-001", "web-002"},
+		},
+		{
+			name: "output map",
+			file: "outputs.json",
+			want: []string{"web-001", "web-002"},
+		},
+		{
+			name: "output named resources",
+			file: "resources.json",
+			opts: LoadOptions{TFResources: []string{"resources"}},
+			want: []string{"web-101"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]interface{}{}
+			sources := map[string]NodeSource{}
+			path := filepath.Join(dir, tt.file)
+			if err := loadTerraform(path, "terraform:"+path, tt.opts, vars, sources); err != nil {
+				t.Fatalf("loadTerraform() error = %v", err)
+			}
+
+			var got []string
+			for key := range vars {
+				got = append(got, key)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadTerraform() nodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// -tf-resources may be repeated and each value may list several globs
+func TestTerraformResourcesOption(t *testing.T) {
+	config := Config{TFResources: stringList{"aws_instance", "gcp_vm, azure_vm"}}
+	want := []string{"aws_instance", "gcp_vm", "azure_vm"}
+	if got := config.loadOptions().TFResources; !reflect.DeepEqual(got, want) {
+		t.Errorf("TFResources = %v, want %v", got, want)
+	}
+}
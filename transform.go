@@ -3,15 +3,89 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"text/template"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
 )
 
 // MappingConfig represents the mapping configuration
 type MappingConfig struct {
 	Operations []OperationRule `yaml:"operations"`
+	Protect    ProtectConfig   `yaml:"protect"`
+	Schema     SchemaConfig    `yaml:"schema"`
+
+	// Mapping source, kept to locate template errors (unset in tests)
+	path string
+	data []byte
+	file *ast.File
+}
+
+// templateError records which field of a rule failed to render, as a path
+// such as template.Service.Tags[0].
+type templateError struct {
+	field string
+	err   error
+}
+
+func (e *templateError) Error() string {
+	return fmt.Sprintf("failed to process %s: %v", e.field, e.err)
+}
+
+func (e *templateError) Unwrap() error {
+	return e.err
+}
+
+// inField prefixes the field path of err with name, a map key or [index].
+func inField(name string, err error) error {
+	inner, ok := err.(*templateError)
+	if !ok {
+		return &templateError{field: name, err: err}
+	}
+	if strings.HasPrefix(inner.field, "[") {
+		return &templateError{field: name + inner.field, err: inner.err}
+	}
+	return &templateError{field: name + "." + inner.field, err: inner.err}
+}
+
+// locate adds the mapping file position of the field that failed in rule
+// to err, falling back to the position of the rule itself.
+func (c *MappingConfig) locate(rule int, err error) error {
+	if c.file == nil {
+		return err
+	}
+
+	fields := []string{fmt.Sprintf("$.operations[%d]", rule)}
+	var tmplErr *templateError
+	if errors.As(err, &tmplErr) {
+		fields = append([]string{fields[0] + "." + tmplErr.field}, fields...)
+	}
+
+	for _, field := range fields {
+		path, perr := yaml.PathString(field)
+		if perr != nil {
+			continue
+		}
+		node, perr := path.FilterFile(c.file)
+		if perr != nil || node == nil || node.GetToken() == nil {
+			continue
+		}
+		pos := node.GetToken().Position
+		return &sourceError{
+			Path:    c.path,
+			Line:    pos.Line,
+			Column:  pos.Column,
+			Message: err.Error(),
+			Excerpt: sourceExcerpt(c.data, pos.Line, pos.Column),
+			Err:     err,
+		}
+	}
+
+	return fmt.Errorf("%s: %w", c.path, err)
 }
 
 // OperationRule defines how to transform vars data into Consul operations
@@ -29,18 +103,23 @@ type ExecutionContext struct {
 	Value      map[string]interface{} // Node data from vars
 	Datacenter string                 // From command line
 	Item       interface{}            // Current item in foreach loop
+	Source     NodeSource             // Vars file the node was loaded from
 }
 
 // GenerateOperations transforms a single node using mapping rules
 func GenerateOperations(ctx ExecutionContext, config *MappingConfig) ([]map[string]interface{}, error) {
 	var operations []map[string]interface{}
 
-	for _, rule := range config.Operations {
+	for i, rule := range config.Operations {
+		locate := func(err error) error {
+			return config.locate(i, err)
+		}
+
 		// Check condition
 		if rule.Condition != "" {
 			result, err := evaluateTemplate(rule.Condition, ctx)
 			if err != nil {
-				log.Printf("[WARN] Failed to evaluate condition for %s: %v", ctx.Key, err)
+				log.Printf("[WARN] Failed to evaluate condition for %s: %v", ctx.Key, locate(inField("condition", err)))
 				continue
 			}
 			// Skip if condition evaluates to empty or "false"
@@ -51,9 +130,9 @@ func GenerateOperations(ctx ExecutionContext, config *MappingConfig) ([]map[stri
 
 		// Handle foreach
 		if rule.Foreach != "" {
-			foreachOps, err := processForeach(rule, ctx)
+			foreachOps, err := processForeach(rule, ctx, locate)
 			if err != nil {
-				log.Printf("[WARN] Failed to process foreach for %s: %v", ctx.Key, err)
+				log.Printf("[WARN] Failed to process foreach for %s: %v", ctx.Key, locate(inField("foreach", err)))
 				continue
 			}
 			operations = append(operations, foreachOps...)
@@ -61,7 +140,7 @@ func GenerateOperations(ctx ExecutionContext, config *MappingConfig) ([]map[stri
 			// Single operation
 			op, err := generateSingleOperation(rule, ctx)
 			if err != nil {
-				log.Printf("[WARN] Failed to generate operation for %s: %v", ctx.Key, err)
+				log.Printf("[WARN] Failed to generate operation for %s: %v", ctx.Key, locate(err))
 				continue
 			}
 			if op != nil {
@@ -77,7 +156,7 @@ func generateSingleOperation(rule OperationRule, ctx ExecutionContext) (map[stri
 	// Process template
 	processed, err := processTemplate(rule.Template, ctx)
 	if err != nil {
-		return nil, fmt.Errorf("template processing failed: %w", err)
+		return nil, fmt.Errorf("template processing failed: %w", inField("template", err))
 	}
 
 	processedMap, ok := processed.(map[string]interface{})
@@ -156,7 +235,34 @@ func wrapCheckOperation(verb string, data map[string]interface{}) (map[string]in
 	}, nil
 }
 
-func processForeach(rule OperationRule, ctx ExecutionContext) ([]map[string]interface{}, error) {
+// describeOperation returns the type, verb and node name of a wrapped
+// operation, the inverse of wrapOperation.
+func describeOperation(op map[string]interface{}) (opType, verb, node string) {
+	for _, t := range []string{"Node", "Service", "Check"} {
+		inner, ok := op[t].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		verb, _ = inner["Verb"].(string)
+		if t == "Node" {
+			data, _ := inner["Node"].(map[string]interface{})
+			node, _ = data["Node"].(string)
+		} else {
+			node, _ = inner["Node"].(string)
+		}
+		return t, verb, node
+	}
+	return "", "", ""
+}
+
+// isDeleteVerb reports whether a verb removes an entry from the catalog.
+func isDeleteVerb(verb string) bool {
+	return strings.HasPrefix(verb, "delete")
+}
+
+// processForeach generates one operation per item; item failures are
+// logged after locate has added their mapping position.
+func processForeach(rule OperationRule, ctx ExecutionContext, locate func(error) error) ([]map[string]interface{}, error) {
 	// Evaluate foreach expression to get items
 	items, err := evaluateForeach(rule.Foreach, ctx)
 	if err != nil {
@@ -176,11 +282,12 @@ func processForeach(rule OperationRule, ctx ExecutionContext) ([]map[string]inte
 			Value:      ctx.Value,
 			Datacenter: ctx.Datacenter,
 			Item:       item,
+			Source:     ctx.Source,
 		}
 
 		op, err := generateSingleOperation(rule, itemCtx)
 		if err != nil {
-			log.Printf("[WARN] Failed to generate operation for item in %s: %v", ctx.Key, err)
+			log.Printf("[WARN] Failed to generate operation for item in %s: %v", ctx.Key, locate(err))
 			continue
 		}
 		if op != nil {
@@ -252,7 +359,7 @@ func processTemplate(templateData interface{}, ctx ExecutionContext) (interface{
 		for key, value := range v {
 			processed, err := processTemplate(value, ctx)
 			if err != nil {
-				return nil, fmt.Errorf("failed to process key %s: %w", key, err)
+				return nil, inField(key, err)
 			}
 			// Skip nil values
 			if processed != nil && processed != "" && processed != "<no value>" {
@@ -264,10 +371,10 @@ func processTemplate(templateData interface{}, ctx ExecutionContext) (interface{
 	case []interface{}:
 		// Process array
 		result := make([]interface{}, 0, len(v))
-		for _, item := range v {
+		for i, item := range v {
 			processed, err := processTemplate(item, ctx)
 			if err != nil {
-				return nil, err
+				return nil, inField(fmt.Sprintf("[%d]", i), err)
 			}
 			// Skip nil values
 			if processed != nil && processed != "" && processed != "<no value>" {
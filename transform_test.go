@@ -511,6 +511,30 @@ func TestEvaluateTemplate(t *testing.T) {
 			},
 			want: "ssh",
 		},
+		{
+			name:     "source directory reference",
+			template: "{{ .Source.Dir }}",
+			ctx: ExecutionContext{
+				Source: NodeSource{Path: "vars/prod/web/items.yaml", Rel: "prod/web/items.yaml"},
+			},
+			want: "prod/web",
+		},
+		{
+			name:     "source directory components and file name",
+			template: "{{ index .Source.Dirs 0 }}-{{ .Source.Name }}",
+			ctx: ExecutionContext{
+				Source: NodeSource{Path: "vars/prod/web/items.yaml", Rel: "prod/web/items.yaml"},
+			},
+			want: "prod-items",
+		},
+		{
+			name:     "top level source has no directory",
+			template: "{{ .Source.Dir }}{{ len .Source.Dirs }}{{ .Source.File }}",
+			ctx: ExecutionContext{
+				Source: NodeSource{Path: "nodes.yaml", Rel: "nodes.yaml"},
+			},
+			want: "0nodes.yaml",
+		},
 	}
 
 	for _, tt := range tests {
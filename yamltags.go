@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// yamlTags expands the custom tags vars files may use:
+//
+//	!file path     contents of a file, without trailing newlines
+//	!env NAME      value of an environment variable, which must be set
+//	!include path  value of another YAML file
+//
+// Relative paths are resolved against the directory of the file the tag
+// appears in.
+type yamlTags struct {
+	dir   string
+	stack []string // Files being included, outermost first, to detect cycles
+}
+
+// newYAMLTags returns the tag resolver for a vars file; path may be "" for
+// data without a file, such as stdin.
+func newYAMLTags(path string) *yamlTags {
+	if path == "" {
+		return &yamlTags{dir: "."}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return &yamlTags{dir: filepath.Dir(path), stack: []string{abs}}
+}
+
+// parseYAMLNodes parses each document of data and expands custom tags when
+// tags is not nil. Empty documents are dropped.
+func parseYAMLNodes(data []byte, tags *yamlTags) ([]ast.Node, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, yamlError("failed to parse YAML", err)
+	}
+
+	var nodes []ast.Node
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+		body := ast.Node(doc.Body)
+		if tags != nil {
+			if body, err = tags.resolve(body); err != nil {
+				return nil, err
+			}
+		}
+		nodes = append(nodes, body)
+	}
+	return nodes, nil
+}
+
+// resolve replaces custom tags below node, returning the node to use in
+// its place.
+func (t *yamlTags) resolve(node ast.Node) (ast.Node, error) {
+	var err error
+	switch n := node.(type) {
+	case *ast.TagNode:
+		switch n.Start.Value {
+		case "!file", "!env", "!include":
+			return t.expand(n)
+		}
+		n.Value, err = t.resolve(n.Value)
+
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			if value.Value, err = t.resolve(value.Value); err != nil {
+				return nil, err
+			}
+		}
+
+	case *ast.MappingValueNode:
+		n.Value, err = t.resolve(n.Value)
+
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			if n.Values[i], err = t.resolve(value); err != nil {
+				return nil, err
+			}
+		}
+
+	case *ast.AnchorNode:
+		n.Value, err = t.resolve(n.Value)
+	}
+
+	return node, err
+}
+
+func (t *yamlTags) expand(n *ast.TagNode) (ast.Node, error) {
+	tag, pos := n.Start.Value, n.Start.Position
+
+	scalar, ok := n.Value.(ast.ScalarNode)
+	if !ok || scalar.GetToken() == nil || scalar.GetToken().Value == "" {
+		return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("%s expects a single value", tag), nil)
+	}
+	arg := scalar.GetToken().Value
+
+	switch tag {
+	case "!env":
+		value, ok := os.LookupEnv(arg)
+		if !ok {
+			return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("!env %s: environment variable is not set", arg), nil)
+		}
+		return stringNode(value, pos), nil
+
+	case "!file":
+		data, err := os.ReadFile(t.path(arg))
+		if err != nil {
+			return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("!file %s: %v", arg, err), err)
+		}
+		return stringNode(strings.TrimRight(string(data), "\r\n"), pos), nil
+
+	default:
+		return t.include(arg, pos)
+	}
+}
+
+// include parses another YAML file, with its own tags resolved relative to
+// it. Errors inside the included file are reported at their position there.
+func (t *yamlTags) include(arg string, pos *token.Position) (ast.Node, error) {
+	path := t.path(arg)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	for _, included := range t.stack {
+		if included == abs {
+			chain := strings.Join(append(t.stack, abs), " -> ")
+			return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("!include %s: include cycle %s", arg, chain), nil)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("!include %s: %v", arg, err), err)
+	}
+
+	nested := &yamlTags{dir: filepath.Dir(path), stack: append(append([]string{}, t.stack...), abs)}
+	nodes, err := parseYAMLNodes(data, nested)
+	if err != nil {
+		return nil, withSource(path, data, err)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return ast.Null(token.New("null", "null", pos)), nil
+	case 1:
+		return nodes[0], nil
+	default:
+		return nil, positionError(pos.Line, pos.Column, fmt.Sprintf("!include %s: file has %d documents, expected one", arg, len(nodes)), nil)
+	}
+}
+
+func (t *yamlTags) path(arg string) string {
+	if filepath.IsAbs(arg) {
+		return arg
+	}
+	return filepath.Join(t.dir, arg)
+}
+
+// stringNode returns a string scalar that is never re-typed as a number or
+// boolean.
+func stringNode(value string, pos *token.Position) ast.Node {
+	return ast.String(&token.Token{
+		Type:     token.StringType,
+		Value:    value,
+		Origin:   value,
+		Position: pos,
+	})
+}
+
+// decodeYAMLNode decodes one parsed document.
+func decodeYAMLNode(node ast.Node) (interface{}, error) {
+	var value interface{}
+	if err := yaml.NodeToValue(node, &value); err != nil {
+		return nil, yamlError("failed to parse YAML", err)
+	}
+	return value, nil
+}
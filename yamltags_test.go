@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// !file, !env and !include resolve relative to the vars file
+func TestLoadYAMLFileTags(t *testing.T) {
+	t.Setenv("SYNC_TEST_OWNER", "platform")
+
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"vars/nodes.yaml": `
+web-001:
+  description: !file files/web.txt
+  owner: !env SYNC_TEST_OWNER
+  ports: !include shared/ports.yaml
+  tags:
+    - web
+    - !env SYNC_TEST_OWNER
+`,
+		"vars/files/web.txt":     "Frontend web server\n",
+		"vars/shared/ports.yaml": "- 80\n- !file ../files/port.txt\n",
+		"vars/files/port.txt":    "443\n",
+	})
+
+	vars, err := loadYAMLFile(filepath.Join(dir, "vars/nodes.yaml"), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadYAMLFile() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"web-001": map[string]interface{}{
+			"description": "Frontend web server",
+			"owner":       "platform",
+			"ports":       []interface{}{uint64(80), "443"},
+			"tags":        []interface{}{"web", "platform"},
+		},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %#v, want %#v", vars, want)
+	}
+}
+
+func TestLoadYAMLFileTagErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeVarsFiles(t, dir, map[string]string{
+		"env.yaml":     "web-001:\n  owner: !env SYNC_TEST_UNSET_VARIABLE\n",
+		"file.yaml":    "web-001:\n  cert: !file missing.pem\n",
+		"cycle-a.yaml": "web-001: !include cycle-b.yaml\n",
+		"cycle-b.yaml": "a: !include cycle-a.yaml\n",
+		"nested.yaml":  "web-001: !include broken.yaml\n",
+		"broken.yaml":  "ip: [10.0.0.1\nport: 80\n",
+	})
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{file: "env.yaml", want: []string{"env.yaml:2:10: !env SYNC_TEST_UNSET_VARIABLE: environment variable is not set"}},
+		{file: "file.yaml", want: []string{"file.yaml:2:9: !file missing.pem"}},
+		{file: "cycle-b.yaml", want: []string{"cycle-a.yaml:1:10: !include cycle-b.yaml: include cycle", "cycle-b.yaml -> "}},
+		{file: "nested.yaml", want: []string{"broken.yaml:2:1: failed to parse YAML", ">    2 | port: 80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := loadYAMLFile(filepath.Join(dir, tt.file), LoadOptions{})
+			if err == nil {
+				t.Fatal("loadYAMLFile() succeeded, want error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %q, want %q", err, want)
+				}
+			}
+		})
+	}
+}